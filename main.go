@@ -1,17 +1,42 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	metrograph "github.com/dangxcx/metrograph-watchlist/pkg"
 	"go.yaml.in/yaml/v4"
 )
 
+//go:generate go run . schema snapshot.schema.json
+
+const overridesFile = "overrides.yaml"
+
 type Config struct {
 	TMDB struct {
-		APIKey string `yaml:"api_key"`
+		APIKey        string  `yaml:"api_key"`
+		AccessToken   string  `yaml:"access_token"`
+		Burst         int     `yaml:"burst"`
+		MaxRetries    *int    `yaml:"max_retries"`
+		Workers       int     `yaml:"workers"`
+		Candidates    int     `yaml:"candidates"`
+		MinConfidence float64 `yaml:"min_confidence"`
+		Cache         struct {
+			File         string `yaml:"file"`
+			TTLHours     int    `yaml:"ttl_hours"`
+			MissTTLHours int    `yaml:"miss_ttl_hours"`
+		} `yaml:"cache"`
+		Export struct {
+			File string `yaml:"file"`
+			Mode string `yaml:"mode"`
+		} `yaml:"export"`
 	} `yaml:"tmdb"`
 	Radarr struct {
 		Host             string `yaml:"host"`
@@ -25,10 +50,44 @@ type Config struct {
 		Host   string `yaml:"host"`
 		APIKey string `yaml:"api_key"`
 	} `yaml:"agregarr"`
+	Crawler struct {
+		SkipFilmPages    bool   `yaml:"skip_film_pages"`
+		UserAgent        string `yaml:"user_agent"`
+		Parallelism      int    `yaml:"parallelism"`
+		DelayMs          int    `yaml:"delay_ms"`
+		RandomDelayMs    int    `yaml:"random_delay_ms"`
+		RespectRobotsTxt bool   `yaml:"respect_robots_txt"`
+		Domains          []struct {
+			Glob          string `yaml:"glob"`
+			Parallelism   int    `yaml:"parallelism"`
+			DelayMs       int    `yaml:"delay_ms"`
+			RandomDelayMs int    `yaml:"random_delay_ms"`
+		} `yaml:"domains"`
+		Cache struct {
+			Dir           string `yaml:"dir"`
+			MaxAgeMinutes int    `yaml:"max_age_minutes"`
+		} `yaml:"cache"`
+		Selectors metrograph.Selectors        `yaml:"selectors"`
+		Health    metrograph.HealthThresholds `yaml:"health"`
+	} `yaml:"crawler"`
+	Store struct {
+		File string `yaml:"file"`
+	} `yaml:"store"`
+	Snapshots struct {
+		Dir           string `yaml:"dir"`
+		Keep          int    `yaml:"keep"`
+		CompressAfter int    `yaml:"compress_after"`
+	} `yaml:"snapshots"`
+	Catalogue struct {
+		File         string `yaml:"file"`
+		ArchiveAfter int    `yaml:"archive_after"`
+	} `yaml:"catalogue"`
 	Settings struct {
 		RateLimitMs int  `yaml:"rate_limit_ms"`
 		Debug       bool `yaml:"debug"`
 	} `yaml:"settings"`
+	Eligibility metrograph.EligibilityPolicy `yaml:"eligibility"`
+	Rules       metrograph.Rules             `yaml:"rules"`
 }
 
 func loadConfig() (*Config, error) {
@@ -47,6 +106,141 @@ func loadConfig() (*Config, error) {
 	return config, nil
 }
 
+// loadSnapshot loads a snapshot file, or "latest" / "latest~N" from the store
+// or snapshot dir.
+func loadSnapshot(ref string, store *metrograph.Store, snapshots metrograph.SnapshotConfig) (metrograph.ScrapedData, string) {
+	data, source, err := metrograph.LoadSnapshot(ref, store, snapshots)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return data, source
+}
+
+// loadActiveSnapshot loads a snapshot for syncing, leaving out series the
+// catalogue has archived.
+func loadActiveSnapshot(ref string, store *metrograph.Store, snapshots metrograph.SnapshotConfig, config *Config) (metrograph.ScrapedData, string) {
+	data, source := loadSnapshot(ref, store, snapshots)
+	catalogue, err := metrograph.LoadCatalogue(config.Catalogue.File, config.Catalogue.ArchiveAfter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return catalogue.DropArchived(data), source
+}
+
+func runStoreCommand(args []string, store *metrograph.Store, snapshots metrograph.SnapshotConfig) error {
+	usage := "Usage: go run main.go store runs [limit]\n" +
+		"       go run main.go store import <json-file>\n" +
+		"       go run main.go store export <json-file|latest|latest~N> <out.json>"
+	if len(args) < 1 {
+		return fmt.Errorf("%s", usage)
+	}
+	if store == nil {
+		return fmt.Errorf("store.file is not set in config.yaml")
+	}
+
+	switch args[0] {
+	case "runs":
+		limit := 20
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid limit %q", args[1])
+			}
+			limit = n
+		}
+		return store.ListRuns(os.Stdout, limit)
+
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("%s", usage)
+		}
+		runID, err := store.ImportJSON(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s as run %d\n", args[1], runID)
+		return nil
+
+	case "export":
+		if len(args) < 3 {
+			return fmt.Errorf("%s", usage)
+		}
+		data, _, err := metrograph.LoadSnapshot(args[1], store, snapshots)
+		if err != nil {
+			return err
+		}
+		return metrograph.ExportJSON(data, args[2])
+
+	default:
+		return fmt.Errorf("unknown store command %q\n%s", args[0], usage)
+	}
+}
+
+func runOverridesCommand(args []string) error {
+	usage := "Usage: go run main.go overrides list\n" +
+		"       go run main.go overrides add [-year N] [-series ID] <title> <tmdb-id|ignore>\n" +
+		"       go run main.go overrides remove [-year N] [-series ID] <title>"
+	if len(args) < 1 {
+		return fmt.Errorf("%s", usage)
+	}
+
+	overrides, err := metrograph.LoadOverrides(overridesFile)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("overrides "+args[0], flag.ContinueOnError)
+	year := fs.Int("year", 0, "only match films with this year")
+	seriesID := fs.String("series", "", "only match films in this vista series ID")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	rest := fs.Args()
+
+	switch args[0] {
+	case "list":
+		if len(overrides.Overrides) == 0 {
+			fmt.Printf("No overrides in %s\n", overridesFile)
+		}
+		for _, ov := range overrides.Overrides {
+			fmt.Println(ov)
+		}
+		return nil
+
+	case "add":
+		if len(rest) < 2 {
+			return fmt.Errorf("%s", usage)
+		}
+		ov := metrograph.Override{Title: rest[0], Year: *year, SeriesID: *seriesID}
+		if rest[1] == "ignore" {
+			ov.Ignore = true
+		} else {
+			tmdbID, err := strconv.Atoi(rest[1])
+			if err != nil || tmdbID <= 0 {
+				return fmt.Errorf("invalid TMDB ID %q", rest[1])
+			}
+			ov.TMDBID = tmdbID
+		}
+		overrides.Add(ov)
+		fmt.Printf("Added override: %s\n", ov)
+
+	case "remove":
+		if len(rest) < 1 {
+			return fmt.Errorf("%s", usage)
+		}
+		ov := metrograph.Override{Title: rest[0], Year: *year, SeriesID: *seriesID}
+		if !overrides.Remove(ov) {
+			return fmt.Errorf("no override found for %s", rest[0])
+		}
+		fmt.Printf("Removed override for %s\n", rest[0])
+
+	default:
+		return fmt.Errorf("%s", usage)
+	}
+
+	return overrides.Save(overridesFile)
+}
+
 func main() {
 	args := os.Args[1:]
 
@@ -56,24 +250,58 @@ func main() {
 		fmt.Printf("Error loading config: %v\n", err)
 		fmt.Println("Falling back to environment variable...")
 
-		// Fallback to environment variable
+		// Fallback to environment variables
 		tmdbAPIKey := os.Getenv("TMDB_API_KEY")
-		if tmdbAPIKey == "" {
+		tmdbAccessToken := os.Getenv("TMDB_ACCESS_TOKEN")
+		if tmdbAPIKey == "" && tmdbAccessToken == "" {
 			fmt.Println("Warning: No TMDB API key found. Movie IDs will not be fetched.")
 		}
 		config = &Config{}
 		config.TMDB.APIKey = tmdbAPIKey
+		config.TMDB.AccessToken = tmdbAccessToken
+	}
+
+	overrides, err := metrograph.LoadOverrides(overridesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Crawl runs live in the SQLite store when one is configured, otherwise
+	// as JSON snapshots in the snapshot dir
+	var store *metrograph.Store
+	if config.Store.File != "" {
+		store, err = metrograph.OpenStore(config.Store.File)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
 	}
 
-	// Check for command line commands
-	if len(args) > 0 {
+	snapshots := metrograph.SnapshotConfig{
+		Dir:           config.Snapshots.Dir,
+		Keep:          config.Snapshots.Keep,
+		CompressAfter: config.Snapshots.CompressAfter,
+	}
+
+	// Which series make it into snapshots, Radarr and collections
+	policy := config.Eligibility
+	if policy.MinConfidence == 0 {
+		policy.MinConfidence = config.TMDB.MinConfidence
+	}
+	rules, err := metrograph.NewRuleSet(config.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check for command line commands; flags go to the default crawl
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
 		switch args[0] {
 		case "radarr":
 			if len(args) < 2 {
-				log.Fatal("Usage: go run main.go radarr <json-file>")
+				log.Fatal("Usage: go run main.go radarr <json-file|latest>")
 			}
 
-			jsonFile := args[1]
+			snapshot, source := loadActiveSnapshot(args[1], store, snapshots, config)
 			if config.Radarr.APIKey == "" || config.Radarr.Host == "" {
 				log.Fatal("Radarr configuration missing in config.yaml")
 			}
@@ -87,7 +315,7 @@ func main() {
 				SearchForMovie:   config.Radarr.SearchForMovie,
 			}
 
-			err := metrograph.ProcessJSONToRadarr(jsonFile, radarrConfig)
+			err := metrograph.ProcessToRadarr(snapshot, source, radarrConfig, policy, rules, overrides, store)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -111,10 +339,10 @@ func main() {
 
 		case "collections":
 			if len(args) < 2 {
-				log.Fatal("Usage: go run main.go collections <json-file>")
+				log.Fatal("Usage: go run main.go collections <json-file|latest>")
 			}
 
-			jsonFile := args[1]
+			snapshot, source := loadActiveSnapshot(args[1], store, snapshots, config)
 			if config.Agregarr.APIKey == "" || config.Agregarr.Host == "" {
 				log.Fatal("Agregarr configuration missing in config.yaml")
 			}
@@ -129,7 +357,7 @@ func main() {
 				APIKey: config.Agregarr.APIKey,
 			}
 
-			err := metrograph.CreateCollectionsFromJSON(jsonFile, radarrConfig, agregarrConfig)
+			err := metrograph.CreateCollections(snapshot, source, radarrConfig, agregarrConfig, policy, rules, overrides, store)
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -172,10 +400,10 @@ func main() {
 
 		case "sync-collections":
 			if len(args) < 2 {
-				log.Fatal("Usage: go run main.go sync-collections <json-file>")
+				log.Fatal("Usage: go run main.go sync-collections <json-file|latest>")
 			}
 
-			jsonFile := args[1]
+			snapshot, source := loadActiveSnapshot(args[1], store, snapshots, config)
 			if config.Agregarr.APIKey == "" || config.Agregarr.Host == "" {
 				log.Fatal("Agregarr configuration missing in config.yaml")
 			}
@@ -193,26 +421,251 @@ func main() {
 				APIKey: config.Agregarr.APIKey,
 			}
 
-			err := metrograph.SyncCollectionsFromJSON(jsonFile, radarrConfig, agregarrConfig)
+			err := metrograph.SyncCollections(snapshot, source, radarrConfig, agregarrConfig, policy, rules, overrides, store)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "cache":
+			if len(args) < 2 {
+				log.Fatal("Usage: go run main.go cache <clear|inspect> [title-filter]")
+			}
+
+			cache, err := metrograph.LoadTMDBCache(
+				config.TMDB.Cache.File,
+				time.Duration(config.TMDB.Cache.TTLHours)*time.Hour,
+				time.Duration(config.TMDB.Cache.MissTTLHours)*time.Hour,
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			switch args[1] {
+			case "clear":
+				if err := cache.Clear(); err != nil {
+					log.Fatal(err)
+				}
+			case "inspect":
+				filter := ""
+				if len(args) > 2 {
+					filter = args[2]
+				}
+				cache.Inspect(filter)
+			default:
+				log.Fatalf("Unknown cache command: %s", args[1])
+			}
+			return
+
+		case "ics":
+			fs := flag.NewFlagSet("ics", flag.ExitOnError)
+			outFile := fs.String("o", "metrograph.ics", "output file, or - for stdout")
+			series := fs.String("series", "", "comma-separated vista series IDs to include")
+			if len(args) < 2 {
+				log.Fatal("Usage: go run main.go ics <json-file|latest> [-o file.ics] [-series id,id]")
+			}
+			fs.Parse(args[2:])
+
+			var seriesIDs []string
+			if *series != "" {
+				seriesIDs = strings.Split(*series, ",")
+			}
+
+			snapshot, source := loadSnapshot(args[1], store, snapshots)
+			err := metrograph.ExportICS(snapshot, source, *outFile, seriesIDs)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "diff":
+			fs := flag.NewFlagSet("diff", flag.ExitOnError)
+			asJSON := fs.Bool("json", false, "write the diff as JSON")
+			// Flags may come before or after the two snapshots
+			fs.Parse(args[1:])
+			refs := fs.Args()
+			if len(refs) > 2 {
+				fs.Parse(refs[2:])
+				refs = append(refs[:2:2], fs.Args()...)
+			}
+			if len(refs) != 2 {
+				log.Fatal("Usage: go run main.go diff [-json] <old.json|latest~1> <new.json|latest>")
+			}
+
+			oldSnapshot, _ := loadSnapshot(refs[0], store, snapshots)
+			newSnapshot, _ := loadSnapshot(refs[1], store, snapshots)
+			if err := metrograph.WriteDiff(oldSnapshot, newSnapshot, *asJSON, os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "validate":
+			if len(args) < 2 {
+				log.Fatal("Usage: go run main.go validate <json-file>")
+			}
+
+			result, err := metrograph.ValidateSnapshot(args[1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(result.Problems) > 0 {
+				fmt.Printf("%s is not a valid schema version %d snapshot:\n", args[1], metrograph.SnapshotSchemaVersion)
+				for _, p := range result.Problems {
+					fmt.Printf("  - %s\n", p)
+				}
+				os.Exit(1)
+			}
+			if result.Version < metrograph.SnapshotSchemaVersion {
+				fmt.Printf("%s is valid (schema version %d, read as %d)\n", args[1], result.Version, metrograph.SnapshotSchemaVersion)
+			} else {
+				fmt.Printf("%s is valid (schema version %d)\n", args[1], result.Version)
+			}
+			return
+
+		case "schema":
+			out := ""
+			if len(args) > 1 {
+				out = args[1]
+			}
+			if err := metrograph.WriteSnapshotSchemaFile(out); err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "explain":
+			if len(args) < 2 {
+				log.Fatal("Usage: go run main.go explain <series-id> [json-file|latest]")
+			}
+			ref := metrograph.SnapshotLatest
+			if len(args) > 2 {
+				ref = args[2]
+			}
+
+			snapshot, source := loadSnapshot(ref, store, snapshots)
+			catalogue, err := metrograph.LoadCatalogue(config.Catalogue.File, config.Catalogue.ArchiveAfter)
 			if err != nil {
 				log.Fatal(err)
 			}
+			metrograph.ApplyOverrides(snapshot.Collections, overrides)
+			if err := metrograph.ExplainEligibility(os.Stdout, args[1], snapshot, source, policy, rules, catalogue); err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "rules":
+			if len(args) < 2 {
+				log.Fatal("Usage: go run main.go rules <json-file|latest>")
+			}
+
+			// Dry run: list what radarr and collections would leave out
+			snapshot, source := loadActiveSnapshot(args[1], store, snapshots, config)
+			metrograph.ApplyOverrides(snapshot.Collections, overrides)
+			fmt.Printf("Applying rules to %s (scraped on %s)\n", source, snapshot.Date)
+			rules.DryRun(os.Stdout, snapshot, policy)
+			return
+
+		case "catalogue":
+			status := ""
+			if len(args) > 1 {
+				status = args[1]
+				if status != metrograph.StatusActive && status != metrograph.StatusArchived {
+					log.Fatal("Usage: go run main.go catalogue [active|archived]")
+				}
+			}
+
+			catalogue, err := metrograph.LoadCatalogue(config.Catalogue.File, config.Catalogue.ArchiveAfter)
+			if err != nil {
+				log.Fatal(err)
+			}
+			catalogue.List(os.Stdout, status)
+			return
+
+		case "overrides":
+			if err := runOverridesCommand(args[1:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+
+		case "store":
+			if err := runStoreCommand(args[1:], store, snapshots); err != nil {
+				log.Fatal(err)
+			}
 			return
 
 		default:
-			log.Fatalf("Unknown command: %s\nAvailable commands: radarr, profiles, collections, sync-collections, test-agregarr, get-collections", args[0])
+			log.Fatalf("Unknown command: %s\nAvailable commands: radarr, profiles, collections, sync-collections, test-agregarr, get-collections, overrides, cache, ics, diff, validate, schema, explain, rules, catalogue, store", args[0])
 		}
 	}
 
 	// Default behavior: scrape and generate JSON
-	results, err := metrograph.Crawl(config.TMDB.APIKey)
+	tmdbConfig := metrograph.TMDBConfig{
+		APIKey:        config.TMDB.APIKey,
+		AccessToken:   config.TMDB.AccessToken,
+		RateLimitMs:   config.Settings.RateLimitMs,
+		Burst:         config.TMDB.Burst,
+		MaxRetries:    config.TMDB.MaxRetries,
+		Workers:       config.TMDB.Workers,
+		Candidates:    config.TMDB.Candidates,
+		MinConfidence: config.TMDB.MinConfidence,
+		CacheFile:     config.TMDB.Cache.File,
+		CacheTTL:      time.Duration(config.TMDB.Cache.TTLHours) * time.Hour,
+		CacheMissTTL:  time.Duration(config.TMDB.Cache.MissTTLHours) * time.Hour,
+		ExportFile:    config.TMDB.Export.File,
+		ExportMode:    config.TMDB.Export.Mode,
+	}
+
+	// Stop outstanding TMDB requests on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	offline := fs.Bool("offline", false, "crawl Metrograph only from crawler.cache.dir")
+	fs.Parse(args)
+
+	crawlerConfig := metrograph.CrawlerConfig{
+		SkipFilmPages: config.Crawler.SkipFilmPages,
+		CacheDir:      config.Crawler.Cache.Dir,
+		CacheMaxAge:   time.Duration(config.Crawler.Cache.MaxAgeMinutes) * time.Minute,
+		Offline:       *offline,
+
+		UserAgent:        config.Crawler.UserAgent,
+		Parallelism:      config.Crawler.Parallelism,
+		Delay:            time.Duration(config.Crawler.DelayMs) * time.Millisecond,
+		RandomDelay:      time.Duration(config.Crawler.RandomDelayMs) * time.Millisecond,
+		RespectRobotsTxt: config.Crawler.RespectRobotsTxt,
+
+		Selectors: config.Crawler.Selectors,
+		Health:    config.Crawler.Health,
+	}
+	for _, d := range config.Crawler.Domains {
+		crawlerConfig.DomainLimits = append(crawlerConfig.DomainLimits, metrograph.DomainLimit{
+			DomainGlob:  d.Glob,
+			Parallelism: d.Parallelism,
+			Delay:       time.Duration(d.DelayMs) * time.Millisecond,
+			RandomDelay: time.Duration(d.RandomDelayMs) * time.Millisecond,
+		})
+	}
+
+	results, err := metrograph.Crawl(ctx, crawlerConfig, tmdbConfig, overrides)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = metrograph.UpdateFileStore(results, "./2026-01-03.json")
+	// Track every series and film seen, including those too small for the snapshot
+	err = metrograph.UpdateCatalogue(config.Catalogue.File, config.Catalogue.ArchiveAfter, results)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if store != nil {
+		if _, err := store.SaveCrawl(results, policy, overrides); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = metrograph.UpdateFileStore(results, snapshots, policy, overrides)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 )
 
@@ -39,6 +39,11 @@ type Collection struct {
 	Subtype   string `json:"subtype,omitempty"`   // tag name for radarr, list ID for others
 	MediaType string `json:"mediaType,omitempty"` // "movie", "tv", "both"
 
+	// Series context
+	Description string `json:"description,omitempty"`
+	StartDate   string `json:"startDate,omitempty"` // YYYY-MM-DD
+	EndDate     string `json:"endDate,omitempty"`   // YYYY-MM-DD
+
 	// Library settings
 	LibraryIds   []string `json:"libraryIds,omitempty"`
 	LibraryNames []string `json:"libraryNames,omitempty"`
@@ -241,16 +246,13 @@ func (a *AgregarrClient) TestConnection() error {
 	return nil
 }
 
-func SyncCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregarrConfig AgregarrConfig) error {
-	data, err := os.ReadFile(jsonFile)
-	if err != nil {
-		return fmt.Errorf("failed to read JSON file %s: %w", jsonFile, err)
-	}
-
-	var scrapedData ScrapedData
-	if err := json.Unmarshal(data, &scrapedData); err != nil {
-		return fmt.Errorf("failed to parse JSON file %s: %w", jsonFile, err)
-	}
+// SyncCollections deletes Metrograph collections and their Radarr tags for
+// series no longer in scrapedData, or now filtered by the rules. Changes are
+// recorded in store when it is not nil.
+func SyncCollections(scrapedData ScrapedData, source string, radarrConfig RadarrConfig, agregarrConfig AgregarrConfig, policy EligibilityPolicy, rules *RuleSet, overrides *Overrides, store *Store) error {
+	ApplyOverrides(scrapedData.Collections, overrides)
+	scrapedData, report := rules.Apply(scrapedData)
+	report.PrintSummary()
 
 	agregarrClient := NewAgregarrClient(agregarrConfig)
 	radarrClient, err := NewRadarrClient(radarrConfig)
@@ -264,22 +266,13 @@ func SyncCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregar
 		return fmt.Errorf("failed to get existing collections: %w", err)
 	}
 
-	fmt.Printf("Syncing collections from %s (scraped on %s)\n", jsonFile, scrapedData.Date)
+	fmt.Printf("Syncing collections from %s (scraped on %s)\n", source, scrapedData.Date)
 
 	// Build a set of expected collection names from the JSON file
 	expectedNames := make(map[string]bool)
 	results := scrapedData.Collections
-	for _, series := range results {
-		// Count valid movies
-		validMovies := 0
-		for _, movie := range series.Movies {
-			if movie.TMDBID > 0 {
-				validMovies++
-			}
-		}
-
-		// Only include series with enough valid movies
-		if validMovies >= 2 {
+	for seriesID, series := range results {
+		if policy.Evaluate(seriesID, series).Eligible {
 			collectionName := fmt.Sprintf("Metrograph: %s", series.Name)
 			expectedNames[collectionName] = true
 		}
@@ -295,7 +288,11 @@ func SyncCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregar
 				fmt.Printf("Deleting collection '%s' (no longer in JSON file)\n", collection.Name)
 
 				// Delete from Agregarr
-				if err := agregarrClient.DeleteCollection(collection.ID); err != nil {
+				err := agregarrClient.DeleteCollection(collection.ID)
+				store.RecordSyncAction(scrapedData, SyncAction{
+					Target: SyncTargetAgregarr, Action: SyncActionDeleteCollection, SeriesID: strings.TrimPrefix(collection.Subtype, "metrograph-"), Detail: collection.Name, Err: err,
+				})
+				if err != nil {
 					fmt.Printf("Warning: Failed to delete collection '%s': %v\n", collection.Name, err)
 				} else {
 					deletedCollectionCount++
@@ -303,7 +300,11 @@ func SyncCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregar
 
 				// Delete corresponding Radarr tag (Subtype contains the tag name like "metrograph-12345")
 				if collection.Subtype != "" && len(collection.Subtype) > 11 && collection.Subtype[:11] == "metrograph-" {
-					if err := radarrClient.DeleteTag(collection.Subtype); err != nil {
+					err := radarrClient.DeleteTag(collection.Subtype)
+					store.RecordSyncAction(scrapedData, SyncAction{
+						Target: SyncTargetRadarr, Action: SyncActionDeleteTag, SeriesID: strings.TrimPrefix(collection.Subtype, "metrograph-"), Detail: collection.Subtype, Err: err,
+					})
+					if err != nil {
 						fmt.Printf("Warning: Failed to delete Radarr tag '%s': %v\n", collection.Subtype, err)
 					} else {
 						deletedTagCount++
@@ -317,16 +318,13 @@ func SyncCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregar
 	return nil
 }
 
-func CreateCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agregarrConfig AgregarrConfig) error {
-	data, err := os.ReadFile(jsonFile)
-	if err != nil {
-		return fmt.Errorf("failed to read JSON file %s: %w", jsonFile, err)
-	}
-
-	var scrapedData ScrapedData
-	if err := json.Unmarshal(data, &scrapedData); err != nil {
-		return fmt.Errorf("failed to parse JSON file %s: %w", jsonFile, err)
-	}
+// CreateCollections creates an Agregarr collection for every eligible series
+// in scrapedData that the rules keep, backed by its Radarr tag. Changes are
+// recorded in store when it is not nil.
+func CreateCollections(scrapedData ScrapedData, source string, radarrConfig RadarrConfig, agregarrConfig AgregarrConfig, policy EligibilityPolicy, rules *RuleSet, overrides *Overrides, store *Store) error {
+	ApplyOverrides(scrapedData.Collections, overrides)
+	scrapedData, report := rules.Apply(scrapedData)
+	report.PrintSummary()
 
 	radarrClient, err := NewRadarrClient(radarrConfig)
 	if err != nil {
@@ -335,18 +333,16 @@ func CreateCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agreg
 
 	agregarrClient := NewAgregarrClient(agregarrConfig)
 
-	fmt.Printf("Creating collections from %d series in %s (scraped on %s)\n", len(scrapedData.Collections), jsonFile, scrapedData.Date)
+	fmt.Printf("Creating collections from %d series in %s (scraped on %s)\n", len(scrapedData.Collections), source, scrapedData.Date)
 	results := scrapedData.Collections
 	for seriesID, series := range results {
-		// Count valid movies
-		validMovies := 0
-		for _, movie := range series.Movies {
-			if movie.TMDBID > 0 {
-				validMovies++
-			}
+		decision := policy.Evaluate(seriesID, series)
+		if !decision.Eligible {
+			fmt.Printf("Skipping '%s': not eligible (see explain %s)\n", series.Name, seriesID)
+			continue
 		}
 
-		fmt.Printf("Creating collection for '%s' with %d movies\n", series.Name, validMovies)
+		fmt.Printf("Creating collection for '%s' with %d movies\n", series.Name, decision.Matched)
 
 		// Get the tag ID from Radarr for this series
 		tagName := fmt.Sprintf("metrograph-%s", seriesID)
@@ -371,6 +367,11 @@ func CreateCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agreg
 			Subtype:   fmt.Sprintf("metrograph-%s", seriesID), // This should match the tag name
 			MediaType: "movie",
 
+			// Series context from the Metrograph series page
+			Description: series.collectionDescription(),
+			StartDate:   series.StartDate,
+			EndDate:     series.EndDate,
+
 			// Library settings - include all libraries (you can adjust this)
 			LibraryIds: []string{"1"}, // Use library ID 1
 
@@ -392,6 +393,9 @@ func CreateCollectionsFromJSON(jsonFile string, radarrConfig RadarrConfig, agreg
 		}
 
 		createdCollection, err := agregarrClient.CreateCollection(collection)
+		store.RecordSyncAction(scrapedData, SyncAction{
+			Target: SyncTargetAgregarr, Action: SyncActionCreateCollection, SeriesID: seriesID, Detail: collectionName, Err: err,
+		})
 		if err != nil {
 			fmt.Printf("Warning: Failed to create collection for series %s: %v\n", series.Name, err)
 			continue
@@ -0,0 +1,286 @@
+package metrograph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTMDBCacheFile    = "tmdb-cache.json"
+	defaultTMDBCacheTTL     = 30 * 24 * time.Hour
+	defaultTMDBCacheMissTTL = 3 * 24 * time.Hour
+)
+
+// Cache keys are "<kind>|<part>|<part>..."
+const (
+	tmdbCacheKeySeparator    = "|"
+	tmdbCacheKindSearch      = "search"
+	tmdbCacheKindCredits     = "credits"
+	tmdbCacheKindAltTitles   = "alternative_titles"
+	tmdbCacheKindDetails     = "details"
+	tmdbCacheInspectMaxLines = 50
+)
+
+// tmdbCacheEntry is one cached TMDB response. Empty marks a lookup that
+// found nothing, which expires sooner than a hit.
+type tmdbCacheEntry struct {
+	Empty    bool            `json:"empty,omitempty"`
+	StoredAt time.Time       `json:"stored_at"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type TMDBCacheStats struct {
+	Served      int // Answered from the cache
+	ServedEmpty int // Of those, cached "no results" responses
+	Fetched     int // Not cached or expired, so sent to TMDB
+	Expired     int
+}
+
+// TMDBCache persists TMDB responses between runs so repeat crawls only
+// query films that are new or whose cache entry has expired.
+type TMDBCache struct {
+	path    string
+	ttl     time.Duration
+	missTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]tmdbCacheEntry
+	stats   TMDBCacheStats
+	dirty   bool
+}
+
+// LoadTMDBCache reads the cache file at path. A missing file gives an empty
+// cache. Zero TTLs fall back to the defaults.
+func LoadTMDBCache(path string, ttl, missTTL time.Duration) (*TMDBCache, error) {
+	if path == "" {
+		path = defaultTMDBCacheFile
+	}
+	if ttl <= 0 {
+		ttl = defaultTMDBCacheTTL
+	}
+	if missTTL <= 0 {
+		missTTL = defaultTMDBCacheMissTTL
+	}
+
+	c := &TMDBCache{
+		path:    path,
+		ttl:     ttl,
+		missTTL: missTTL,
+		entries: make(map[string]tmdbCacheEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TMDB cache %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse TMDB cache %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+func tmdbCacheKey(parts ...string) string {
+	return strings.Join(parts, tmdbCacheKeySeparator)
+}
+
+func (c *TMDBCache) expired(e tmdbCacheEntry) bool {
+	ttl := c.ttl
+	if e.Empty {
+		ttl = c.missTTL
+	}
+	return time.Since(e.StoredAt) > ttl
+}
+
+// Get decodes a fresh cached response for key into out and reports whether
+// one was found.
+func (c *TMDBCache) Get(key string, out any) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Fetched++
+		return false
+	}
+	if c.expired(e) {
+		c.stats.Expired++
+		c.stats.Fetched++
+		return false
+	}
+	if err := json.Unmarshal(e.Data, out); err != nil {
+		c.stats.Fetched++
+		return false
+	}
+
+	c.stats.Served++
+	if e.Empty {
+		c.stats.ServedEmpty++
+	}
+	return true
+}
+
+func (c *TMDBCache) Put(key string, value any, empty bool) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = tmdbCacheEntry{
+		Empty:    empty,
+		StoredAt: time.Now(),
+		Data:     data,
+	}
+	c.dirty = true
+}
+
+// Save writes the cache back to disk if anything changed, dropping expired
+// entries on the way.
+func (c *TMDBCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	for key, e := range c.entries {
+		if c.expired(e) {
+			delete(c.entries, key)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode TMDB cache: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write TMDB cache %s: %w", c.path, err)
+	}
+
+	c.dirty = false
+	return nil
+}
+
+func (c *TMDBCache) Stats() TMDBCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *TMDBCache) PrintStats() {
+	st := c.Stats()
+	fmt.Printf("TMDB cache: %d served (%d cached misses), %d fetched, %d expired\n", st.Served, st.ServedEmpty, st.Fetched, st.Expired)
+}
+
+// Clear removes every entry and deletes the cache file.
+func (c *TMDBCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := len(c.entries)
+	c.entries = make(map[string]tmdbCacheEntry)
+	c.dirty = false
+
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove TMDB cache %s: %w", c.path, err)
+	}
+
+	fmt.Printf("Cleared %d TMDB cache entries from %s\n", count, c.path)
+	return nil
+}
+
+// Inspect prints a summary of the cache by kind, plus the entries whose key
+// contains filter when one is given.
+func (c *TMDBCache) Inspect(filter string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type kindStats struct {
+		hits, misses, expired int
+	}
+	kinds := make(map[string]*kindStats)
+	var oldest, newest time.Time
+	var matching []string
+
+	for key, e := range c.entries {
+		kind, _, _ := strings.Cut(key, tmdbCacheKeySeparator)
+		ks, ok := kinds[kind]
+		if !ok {
+			ks = &kindStats{}
+			kinds[kind] = ks
+		}
+
+		switch {
+		case c.expired(e):
+			ks.expired++
+		case e.Empty:
+			ks.misses++
+		default:
+			ks.hits++
+		}
+
+		if oldest.IsZero() || e.StoredAt.Before(oldest) {
+			oldest = e.StoredAt
+		}
+		if e.StoredAt.After(newest) {
+			newest = e.StoredAt
+		}
+
+		if filter != "" && strings.Contains(key, normalizeTitle(filter)) {
+			matching = append(matching, key)
+		}
+	}
+
+	fmt.Printf("TMDB cache %s: %d entries (hit TTL %s, miss TTL %s)\n", c.path, len(c.entries), c.ttl, c.missTTL)
+	if len(c.entries) > 0 {
+		fmt.Printf("Oldest entry %s, newest %s\n", oldest.Format(time.RFC3339), newest.Format(time.RFC3339))
+	}
+
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	for _, kind := range names {
+		ks := kinds[kind]
+		fmt.Printf("  %s: %d hits, %d misses, %d expired\n", kind, ks.hits, ks.misses, ks.expired)
+	}
+
+	if filter == "" {
+		return
+	}
+
+	sort.Strings(matching)
+	fmt.Printf("%d entries matching %q\n", len(matching), filter)
+	for i, key := range matching {
+		if i == tmdbCacheInspectMaxLines {
+			fmt.Printf("  ... and %d more\n", len(matching)-i)
+			break
+		}
+		e := c.entries[key]
+		state := "hit"
+		if e.Empty {
+			state = "miss"
+		}
+		if c.expired(e) {
+			state += ", expired"
+		}
+		fmt.Printf("  %s (%s, stored %s)\n", key, state, e.StoredAt.Format(time.RFC3339))
+	}
+}
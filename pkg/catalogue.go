@@ -0,0 +1,261 @@
+package metrograph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	defaultCatalogueFile         = "catalogue.json"
+	defaultCatalogueArchiveAfter = 2
+
+	// A series or film is active while it keeps showing up in crawls, and
+	// archived once it has been missing from ArchiveAfter crawls in a row
+	StatusActive   = "active"
+	StatusArchived = "archived"
+)
+
+// CatalogueFilm is every sighting of one film within a series.
+type CatalogueFilm struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Year      int       `json:"year,omitempty"`
+	TMDBID    int       `json:"tmdb_id,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Status    string    `json:"status"`
+}
+
+// CatalogueSeries is every sighting of one series and the films it has
+// listed.
+type CatalogueSeries struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	StartDate string    `json:"start_date,omitempty"`
+	EndDate   string    `json:"end_date,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Status    string    `json:"status"`
+	Misses    int       `json:"misses,omitempty"` // Consecutive crawls without this series
+
+	Films map[string]*CatalogueFilm `json:"films"`
+}
+
+// Catalogue remembers every series and film any crawl has found, unlike
+// snapshots which only hold the latest crawl.
+type Catalogue struct {
+	path         string
+	archiveAfter int
+
+	Crawls    int                         `json:"crawls"`
+	UpdatedAt time.Time                   `json:"updated_at"`
+	Series    map[string]*CatalogueSeries `json:"series"`
+}
+
+// CatalogueChanges counts what one crawl changed in the catalogue.
+type CatalogueChanges struct {
+	NewSeries      int
+	ArchivedSeries int
+	ReturnedSeries int // Archived series seen again
+	NewFilms       int
+}
+
+// LoadCatalogue reads the catalogue at path. A missing file gives an empty
+// catalogue. archiveAfter <= 0 falls back to the default.
+func LoadCatalogue(path string, archiveAfter int) (*Catalogue, error) {
+	if path == "" {
+		path = defaultCatalogueFile
+	}
+	if archiveAfter <= 0 {
+		archiveAfter = defaultCatalogueArchiveAfter
+	}
+
+	c := &Catalogue{
+		path:         path,
+		archiveAfter: archiveAfter,
+		Series:       make(map[string]*CatalogueSeries),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalogue %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse catalogue %s: %w", path, err)
+	}
+	if c.Series == nil {
+		c.Series = make(map[string]*CatalogueSeries)
+	}
+
+	return c, nil
+}
+
+// Update records a crawl made at crawledAt. Series and films in results
+// become active; ones missing from archiveAfter crawls in a row are archived.
+func (c *Catalogue) Update(results map[string]Series, crawledAt time.Time) CatalogueChanges {
+	var changes CatalogueChanges
+	c.Crawls++
+	c.UpdatedAt = crawledAt
+
+	for id, s := range results {
+		cs, ok := c.Series[id]
+		if !ok {
+			cs = &CatalogueSeries{
+				ID:        id,
+				FirstSeen: crawledAt,
+				Films:     make(map[string]*CatalogueFilm),
+			}
+			c.Series[id] = cs
+			changes.NewSeries++
+		} else if cs.Status == StatusArchived {
+			changes.ReturnedSeries++
+		}
+
+		cs.Name = s.Name
+		cs.URL = s.URL
+		cs.StartDate = s.StartDate
+		cs.EndDate = s.EndDate
+		cs.LastSeen = crawledAt
+		cs.Status = StatusActive
+		cs.Misses = 0
+
+		seen := make(map[string]bool)
+		for _, f := range s.Movies {
+			key := f.StableID()
+			seen[key] = true
+
+			cf, ok := cs.Films[key]
+			if !ok {
+				cf = &CatalogueFilm{ID: key, FirstSeen: crawledAt}
+				cs.Films[key] = cf
+				changes.NewFilms++
+			}
+			cf.Title = f.Title
+			cf.Year = f.Year
+			cf.TMDBID = f.matchedTMDBID()
+			cf.LastSeen = crawledAt
+			cf.Status = StatusActive
+		}
+
+		// A film dropped from a series that is still listed has left it
+		for key, cf := range cs.Films {
+			if !seen[key] {
+				cf.Status = StatusArchived
+			}
+		}
+	}
+
+	for id, cs := range c.Series {
+		if _, ok := results[id]; ok || cs.Status == StatusArchived {
+			continue
+		}
+		cs.Misses++
+		if cs.Misses >= c.archiveAfter {
+			cs.Status = StatusArchived
+			for _, cf := range cs.Films {
+				cf.Status = StatusArchived
+			}
+			changes.ArchivedSeries++
+		}
+	}
+
+	return changes
+}
+
+// Status returns the status of a series, or "" when it has never been seen.
+func (c *Catalogue) Status(seriesID string) string {
+	if cs, ok := c.Series[seriesID]; ok {
+		return cs.Status
+	}
+	return ""
+}
+
+// DropArchived returns a copy of data without the series the catalogue has
+// archived, so syncing an older snapshot neither adds their films to Radarr
+// nor keeps their collections. Series the catalogue has not seen are kept.
+func (c *Catalogue) DropArchived(data ScrapedData) ScrapedData {
+	filtered := data
+	filtered.Collections = make(map[string]Series)
+	for id, s := range data.Collections {
+		if c.Status(id) == StatusArchived {
+			fmt.Printf("Skipping '%s': archived in the catalogue\n", s.Name)
+			continue
+		}
+		filtered.Collections[id] = s
+	}
+	return filtered
+}
+
+func (c *Catalogue) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalogue: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write catalogue %s: %w", c.path, err)
+	}
+	return nil
+}
+
+func (c *Catalogue) PrintChanges(changes CatalogueChanges) {
+	active := 0
+	for _, cs := range c.Series {
+		if cs.Status == StatusActive {
+			active++
+		}
+	}
+	fmt.Printf("Catalogue: %d active and %d archived series; %d new, %d returned, %d archived, %d new films\n",
+		active, len(c.Series)-active, changes.NewSeries, changes.ReturnedSeries, changes.ArchivedSeries, changes.NewFilms)
+}
+
+// List writes every series with the given status, or all series when status
+// is empty, most recently seen first.
+func (c *Catalogue) List(w io.Writer, status string) {
+	var series []*CatalogueSeries
+	for _, cs := range c.Series {
+		if status == "" || cs.Status == status {
+			series = append(series, cs)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if !series[i].LastSeen.Equal(series[j].LastSeen) {
+			return series[i].LastSeen.After(series[j].LastSeen)
+		}
+		return series[i].Name < series[j].Name
+	})
+
+	for _, cs := range series {
+		active := 0
+		for _, cf := range cs.Films {
+			if cf.Status == StatusActive {
+				active++
+			}
+		}
+		fmt.Fprintf(w, "%-8s %-10s %s (%s) seen %s to %s, %d/%d films showing\n",
+			cs.Status, cs.ID, cs.Name, cs.URL,
+			cs.FirstSeen.Format("2006-01-02"), cs.LastSeen.Format("2006-01-02"),
+			active, len(cs.Films))
+	}
+}
+
+// UpdateCatalogue loads the catalogue at path, records a crawl and saves it.
+func UpdateCatalogue(path string, archiveAfter int, results map[string]Series) error {
+	c, err := LoadCatalogue(path, archiveAfter)
+	if err != nil {
+		return err
+	}
+
+	c.PrintChanges(c.Update(results, time.Now()))
+	return c.Save()
+}
@@ -0,0 +1,235 @@
+package metrograph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SnapshotDiff is what changed between two crawls.
+type SnapshotDiff struct {
+	OldDate       string       `json:"old_date"`
+	NewDate       string       `json:"new_date"`
+	AddedSeries   []SeriesRef  `json:"added_series,omitempty"`
+	RemovedSeries []SeriesRef  `json:"removed_series,omitempty"`
+	ChangedSeries []SeriesDiff `json:"changed_series,omitempty"`
+}
+
+type SeriesRef struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Films int    `json:"films"`
+}
+
+// SeriesDiff lists film changes within a series present in both snapshots.
+type SeriesDiff struct {
+	ID             string        `json:"id"`
+	Name           string        `json:"name"`
+	AddedFilms     []FilmRef     `json:"added_films,omitempty"`
+	RemovedFilms   []FilmRef     `json:"removed_films,omitempty"`
+	ChangedMatches []MatchChange `json:"changed_matches,omitempty"`
+}
+
+type FilmRef struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Year   int    `json:"year,omitempty"`
+	TMDBID int    `json:"tmdb_id,omitempty"`
+}
+
+// MatchChange is a film whose TMDB match differs between snapshots. A zero
+// TMDB ID means unmatched or ignored.
+type MatchChange struct {
+	Film          FilmRef `json:"film"`
+	OldTMDBID     int     `json:"old_tmdb_id"`
+	NewTMDBID     int     `json:"new_tmdb_id"`
+	OldConfidence float64 `json:"old_confidence,omitempty"`
+	NewConfidence float64 `json:"new_confidence,omitempty"`
+}
+
+func (d SnapshotDiff) Empty() bool {
+	return len(d.AddedSeries) == 0 && len(d.RemovedSeries) == 0 && len(d.ChangedSeries) == 0
+}
+
+func newFilmRef(f Film) FilmRef {
+	return FilmRef{ID: f.StableID(), Title: f.Title, Year: f.Year, TMDBID: f.matchedTMDBID()}
+}
+
+func (f Film) matchedTMDBID() int {
+	if f.Ignored {
+		return 0
+	}
+	return f.TMDBID
+}
+
+func seriesRef(id string, s Series) SeriesRef {
+	return SeriesRef{ID: id, Name: s.Name, Films: len(s.Movies)}
+}
+
+// DiffSnapshots compares two snapshots, matching series by ID and films by
+// StableID.
+func DiffSnapshots(oldData, newData ScrapedData) SnapshotDiff {
+	d := SnapshotDiff{OldDate: oldData.Date, NewDate: newData.Date}
+
+	for id, s := range newData.Collections {
+		old, ok := oldData.Collections[id]
+		if !ok {
+			d.AddedSeries = append(d.AddedSeries, seriesRef(id, s))
+			continue
+		}
+		if sd := diffSeries(id, old, s); len(sd.AddedFilms)+len(sd.RemovedFilms)+len(sd.ChangedMatches) > 0 {
+			d.ChangedSeries = append(d.ChangedSeries, sd)
+		}
+	}
+	for id, s := range oldData.Collections {
+		if _, ok := newData.Collections[id]; !ok {
+			d.RemovedSeries = append(d.RemovedSeries, seriesRef(id, s))
+		}
+	}
+
+	sortSeriesRefs(d.AddedSeries)
+	sortSeriesRefs(d.RemovedSeries)
+	sort.Slice(d.ChangedSeries, func(i, j int) bool {
+		return d.ChangedSeries[i].Name < d.ChangedSeries[j].Name
+	})
+	return d
+}
+
+func diffSeries(id string, oldSeries, newSeries Series) SeriesDiff {
+	sd := SeriesDiff{ID: id, Name: newSeries.Name}
+
+	oldFilms := make(map[string]Film)
+	for _, f := range oldSeries.Movies {
+		oldFilms[f.StableID()] = f
+	}
+	newFilms := make(map[string]Film)
+	for _, f := range newSeries.Movies {
+		newFilms[f.StableID()] = f
+	}
+
+	// A film's StableID changes when its Metrograph ID or URL first shows up
+	// or, without those, when it is matched to another TMDB ID, which looks
+	// like a removal and an addition; pair those up again by title. Films
+	// sharing a title are kept apart and only paired when their years agree
+	// or one is unknown.
+	removedByTitle := make(map[string][]Film)
+	for key, f := range oldFilms {
+		if _, ok := newFilms[key]; !ok {
+			title := normalizeTitle(f.Title)
+			removedByTitle[title] = append(removedByTitle[title], f)
+		}
+	}
+	takeRemoved := func(f Film) (Film, bool) {
+		title := normalizeTitle(f.Title)
+		if title == "" {
+			return Film{}, false
+		}
+		candidates := removedByTitle[title]
+		for i, old := range candidates {
+			if old.Year == f.Year || old.Year == 0 || f.Year == 0 {
+				removedByTitle[title] = append(candidates[:i:i], candidates[i+1:]...)
+				return old, true
+			}
+		}
+		return Film{}, false
+	}
+
+	for key, f := range newFilms {
+		old, ok := oldFilms[key]
+		if !ok {
+			old, ok = takeRemoved(f)
+			if !ok {
+				sd.AddedFilms = append(sd.AddedFilms, newFilmRef(f))
+				continue
+			}
+		}
+		if old.matchedTMDBID() != f.matchedTMDBID() {
+			sd.ChangedMatches = append(sd.ChangedMatches, MatchChange{
+				Film:          newFilmRef(f),
+				OldTMDBID:     old.matchedTMDBID(),
+				NewTMDBID:     f.matchedTMDBID(),
+				OldConfidence: old.Confidence,
+				NewConfidence: f.Confidence,
+			})
+		}
+	}
+	for _, films := range removedByTitle {
+		for _, f := range films {
+			sd.RemovedFilms = append(sd.RemovedFilms, newFilmRef(f))
+		}
+	}
+
+	sortFilmRefs(sd.AddedFilms)
+	sortFilmRefs(sd.RemovedFilms)
+	sort.Slice(sd.ChangedMatches, func(i, j int) bool {
+		return sd.ChangedMatches[i].Film.Title < sd.ChangedMatches[j].Film.Title
+	})
+	return sd
+}
+
+func sortSeriesRefs(refs []SeriesRef) {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+}
+
+func sortFilmRefs(refs []FilmRef) {
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Title < refs[j].Title })
+}
+
+func (r FilmRef) String() string {
+	s := r.Title
+	if r.Year > 0 {
+		s += fmt.Sprintf(" (%d)", r.Year)
+	}
+	return s
+}
+
+func describeTMDBID(id int) string {
+	if id == 0 {
+		return "unmatched"
+	}
+	return fmt.Sprintf("tmdb %d", id)
+}
+
+// WriteText writes the diff for reading in a terminal.
+func (d SnapshotDiff) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Changes from %s to %s\n", d.OldDate, d.NewDate)
+	if d.Empty() {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+
+	for _, s := range d.AddedSeries {
+		fmt.Fprintf(w, "+ series %s (%s), %d films\n", s.Name, s.ID, s.Films)
+	}
+	for _, s := range d.RemovedSeries {
+		fmt.Fprintf(w, "- series %s (%s), %d films\n", s.Name, s.ID, s.Films)
+	}
+
+	for _, s := range d.ChangedSeries {
+		fmt.Fprintf(w, "~ series %s (%s)\n", s.Name, s.ID)
+		for _, f := range s.AddedFilms {
+			fmt.Fprintf(w, "    + %s\n", f)
+		}
+		for _, f := range s.RemovedFilms {
+			fmt.Fprintf(w, "    - %s\n", f)
+		}
+		for _, m := range s.ChangedMatches {
+			fmt.Fprintf(w, "    ~ %s: %s -> %s\n", m.Film, describeTMDBID(m.OldTMDBID), describeTMDBID(m.NewTMDBID))
+		}
+	}
+}
+
+// WriteDiff compares two snapshots and writes the diff as text, or as JSON
+// when asJSON is set.
+func WriteDiff(oldData, newData ScrapedData, asJSON bool, w io.Writer) error {
+	d := DiffSnapshots(oldData, newData)
+	if !asJSON {
+		d.WriteText(w)
+		return nil
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
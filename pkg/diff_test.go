@@ -0,0 +1,81 @@
+package metrograph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSeries(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     []Film
+		new     []Film
+		added   []string
+		removed []string
+		changed []string
+	}{
+		{
+			name: "one title in two years",
+			old: []Film{
+				{ID: "title-hamlet-1948", Title: "Hamlet", Year: 1948},
+				{ID: "tmdb-10549", Title: "Hamlet", Year: 1996, TMDBID: 10549},
+			},
+			new: []Film{
+				{ID: "vista-77", Title: "Hamlet", Year: 1996, TMDBID: 10549},
+			},
+			removed: []string{"Hamlet (1948)"},
+		},
+		{
+			name:    "same title in another year is not paired",
+			old:     []Film{{ID: "title-hamlet-1948", Title: "Hamlet", Year: 1948}},
+			new:     []Film{{ID: "vista-77", Title: "Hamlet", Year: 1996}},
+			added:   []string{"Hamlet (1996)"},
+			removed: []string{"Hamlet (1948)"},
+		},
+		{
+			name:    "unknown year pairs with a known one",
+			old:     []Film{{ID: "tmdb-5", Title: "Carol", TMDBID: 5}},
+			new:     []Film{{ID: "tmdb-258480", Title: "Carol", Year: 2015, TMDBID: 258480}},
+			changed: []string{"Carol (2015): tmdb 5 -> tmdb 258480"},
+		},
+		{
+			name: "ID changes from title to vista",
+			old:  []Film{{ID: "title-daisies-1966", Title: "Daisies", Year: 1966, TMDBID: 46919}},
+			new:  []Film{{ID: "vista-123", Title: "Daisies", Year: 1966, TMDBID: 46919}},
+		},
+		{
+			name:    "film added and removed",
+			old:     []Film{{ID: "vista-1", Title: "Safe", Year: 1995}},
+			new:     []Film{{ID: "vista-2", Title: "Carol", Year: 2015}},
+			added:   []string{"Carol (2015)"},
+			removed: []string{"Safe (1995)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd := diffSeries("1", Series{Movies: tt.old}, Series{Movies: tt.new})
+
+			var added, removed, changed []string
+			for _, f := range sd.AddedFilms {
+				added = append(added, f.String())
+			}
+			for _, f := range sd.RemovedFilms {
+				removed = append(removed, f.String())
+			}
+			for _, m := range sd.ChangedMatches {
+				changed = append(changed, m.Film.String()+": "+describeTMDBID(m.OldTMDBID)+" -> "+describeTMDBID(m.NewTMDBID))
+			}
+
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added = %v, want %v", added, tt.added)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed = %v, want %v", removed, tt.removed)
+			}
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package metrograph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+const defaultEligibilityMinMatchedFilms = 3
+
+// EligibilityPolicy decides which series are kept in snapshots, added to
+// Radarr and turned into collections. A zero MinMatchedFilms or MinConfidence
+// falls back to the default; a negative value disables that check. Series
+// are picked by ID or name with Rules instead.
+type EligibilityPolicy struct {
+	MinMatchedFilms int     `yaml:"min_matched_films"` // Distinct confident TMDB matches
+	MinMatchRatio   float64 `yaml:"min_match_ratio"`   // Matched share of the listed films
+	MinConfidence   float64 `yaml:"min_confidence"`    // Matches scored below this do not count
+}
+
+func (p EligibilityPolicy) withDefaults() EligibilityPolicy {
+	if p.MinMatchedFilms == 0 {
+		p.MinMatchedFilms = defaultEligibilityMinMatchedFilms
+	}
+	if p.MinConfidence == 0 {
+		p.MinConfidence = defaultTMDBMinConfidence
+	}
+	return p
+}
+
+// EligibilityDecision is whether one series passed the policy, and why.
+type EligibilityDecision struct {
+	SeriesID string
+	Name     string
+	Eligible bool
+
+	Films         int // Listed in the series
+	Matched       int // Distinct TMDB IDs with a confident match
+	LowConfidence int // Matched below MinConfidence
+	Ignored       int // Ignored by an override
+
+	Checks []EligibilityCheck
+}
+
+// EligibilityCheck is one rule of the policy applied to a series.
+type EligibilityCheck struct {
+	Rule   string
+	Passed bool
+	Detail string
+}
+
+// matchedFilm reports whether f counts towards a series' matched films and is
+// one to add to Radarr.
+func (p EligibilityPolicy) matchedFilm(f Film) bool {
+	return !f.Ignored && f.confidentMatch(p.withDefaults().MinConfidence)
+}
+
+// MatchedFilms returns the films of s the policy trusts, one per TMDB ID.
+func (p EligibilityPolicy) MatchedFilms(s Series) []Film {
+	var films []Film
+	seen := make(map[int]bool)
+	for _, f := range s.Movies {
+		if p.matchedFilm(f) && !seen[f.TMDBID] {
+			seen[f.TMDBID] = true
+			films = append(films, f)
+		}
+	}
+	return films
+}
+
+// Evaluate applies the policy to one series.
+func (p EligibilityPolicy) Evaluate(seriesID string, s Series) EligibilityDecision {
+	p = p.withDefaults()
+	d := EligibilityDecision{
+		SeriesID: seriesID,
+		Name:     s.Name,
+		Films:    len(s.Movies),
+		Matched:  len(p.MatchedFilms(s)),
+	}
+	for _, f := range s.Movies {
+		switch {
+		case f.Ignored:
+			d.Ignored++
+		case f.TMDBID > 0 && !f.confidentMatch(p.MinConfidence):
+			d.LowConfidence++
+		}
+	}
+
+	d.Eligible = true
+	if p.MinMatchedFilms > 0 {
+		passed := d.Matched >= p.MinMatchedFilms
+		d.Checks = append(d.Checks, EligibilityCheck{
+			Rule:   "min_matched_films",
+			Passed: passed,
+			Detail: fmt.Sprintf("%d matched films, need %d", d.Matched, p.MinMatchedFilms),
+		})
+		d.Eligible = d.Eligible && passed
+	}
+	if p.MinMatchRatio > 0 {
+		ratio := 0.0
+		if d.Films > 0 {
+			ratio = float64(d.Matched) / float64(d.Films)
+		}
+		passed := ratio >= p.MinMatchRatio
+		d.Checks = append(d.Checks, EligibilityCheck{
+			Rule:   "min_match_ratio",
+			Passed: passed,
+			Detail: fmt.Sprintf("%.0f%% of %d films matched, need %.0f%%", ratio*100, d.Films, p.MinMatchRatio*100),
+		})
+		d.Eligible = d.Eligible && passed
+	}
+	return d
+}
+
+// EligibleSeries returns the series in collections that pass the policy.
+func (p EligibilityPolicy) EligibleSeries(collections map[string]Series) map[string]Series {
+	eligible := make(map[string]Series)
+	for id, s := range collections {
+		if p.Evaluate(id, s).Eligible {
+			eligible[id] = s
+		}
+	}
+	return eligible
+}
+
+// WriteText writes the decision for reading in a terminal.
+func (d EligibilityDecision) WriteText(w io.Writer) {
+	verdict := "not eligible"
+	if d.Eligible {
+		verdict = "eligible"
+	}
+	fmt.Fprintf(w, "Series %s (%s) is %s\n", d.Name, d.SeriesID, verdict)
+	fmt.Fprintf(w, "  %d films listed, %d matched, %d below min_confidence, %d ignored by overrides\n",
+		d.Films, d.Matched, d.LowConfidence, d.Ignored)
+
+	for _, c := range d.Checks {
+		mark := "FAIL"
+		if c.Passed {
+			mark = "ok"
+		}
+		fmt.Fprintf(w, "  %-4s %s: %s\n", mark, c.Rule, c.Detail)
+	}
+}
+
+// ExplainEligibility writes why a series is in or out, after the rules as
+// radarr and collections apply them. A series missing from the snapshot,
+// which only keeps eligible series, is evaluated from its last sighting in the
+// catalogue when one is given.
+func ExplainEligibility(w io.Writer, seriesID string, data ScrapedData, source string, policy EligibilityPolicy, rules *RuleSet, catalogue *Catalogue) error {
+	if s, ok := data.Collections[seriesID]; ok {
+		fmt.Fprintf(w, "From %s (scraped on %s)\n", source, data.Date)
+		explainSeries(w, seriesID, s, policy, rules)
+		return nil
+	}
+
+	var cs *CatalogueSeries
+	if catalogue != nil {
+		cs = catalogue.Series[seriesID]
+	}
+	if cs == nil {
+		return fmt.Errorf("series %s is not in %s or the catalogue", seriesID, source)
+	}
+
+	fmt.Fprintf(w, "Not in %s; from the catalogue (%s, last seen %s), without match confidence\n",
+		source, cs.Status, cs.LastSeen.Format("2006-01-02"))
+	explainSeries(w, seriesID, cs.lastSeries(), policy, rules)
+	return nil
+}
+
+func explainSeries(w io.Writer, seriesID string, s Series, policy EligibilityPolicy, rules *RuleSet) {
+	filtered, report := rules.Apply(ScrapedData{Collections: map[string]Series{seriesID: s}})
+	kept, ok := filtered.Collections[seriesID]
+	if !ok {
+		fmt.Fprintf(w, "Series %s (%s) is filtered by the rules: %s\n", s.Name, seriesID, report.Exclusions[0].Reason)
+		return
+	}
+
+	policy.Evaluate(seriesID, kept).WriteText(w)
+	for _, e := range report.Exclusions {
+		fmt.Fprintf(w, "  rules filter %s: %s\n", e.Film, e.Reason)
+	}
+}
+
+// lastSeries rebuilds the series as the catalogue last saw it.
+func (cs *CatalogueSeries) lastSeries() Series {
+	s := Series{ID: cs.ID, Name: cs.Name, URL: cs.URL}
+	for _, cf := range cs.Films {
+		if cf.LastSeen.Equal(cs.LastSeen) {
+			s.Movies = append(s.Movies, Film{ID: cf.ID, Title: cf.Title, Year: cf.Year, TMDBID: cf.TMDBID})
+		}
+	}
+	sort.Slice(s.Movies, func(i, j int) bool { return s.Movies[i].Title < s.Movies[j].Title })
+	return s
+}
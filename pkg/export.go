@@ -0,0 +1,125 @@
+package metrograph
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	StrategyOfflineExport = "offline-export"
+
+	// Export modes: consult the export before calling the API, or only when
+	// the API is unavailable
+	ExportModeFirst    = "first"
+	ExportModeFallback = "fallback"
+
+	// Confidence is scaled by this when several export entries share a title
+	exportAmbiguityPenalty = 0.6
+)
+
+// TMDBExportEntry is one line of TMDB's daily movie ID export
+// (movie_ids_MM_DD_YYYY.json.gz).
+type TMDBExportEntry struct {
+	ID            int     `json:"id"`
+	OriginalTitle string  `json:"original_title"`
+	Popularity    float64 `json:"popularity"`
+	Adult         bool    `json:"adult"`
+	Video         bool    `json:"video"`
+}
+
+// TMDBExportIndex maps normalized original titles to TMDB IDs so films can
+// be matched without calling the API. The export carries no release year,
+// so matches are scored on title alone.
+type TMDBExportIndex struct {
+	byTitle map[string][]TMDBExportEntry
+	count   int
+}
+
+// LoadTMDBExport reads a TMDB daily ID export, gzipped or plain.
+func LoadTMDBExport(path string) (*TMDBExportIndex, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open TMDB export %s: %w", path, err)
+	}
+	defer file.Close()
+
+	br := bufio.NewReader(file)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TMDB export %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	idx := &TMDBExportIndex{byTitle: make(map[string][]TMDBExportEntry)}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e TMDBExportEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Adult || e.Video || e.ID == 0 {
+			continue
+		}
+
+		key := normalizeTitle(e.OriginalTitle)
+		if key == "" {
+			continue
+		}
+		idx.byTitle[key] = append(idx.byTitle[key], e)
+		idx.count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read TMDB export %s: %w", path, err)
+	}
+
+	// Most popular first, so ambiguous titles resolve to the likeliest film
+	for _, entries := range idx.byTitle {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Popularity > entries[j].Popularity
+		})
+	}
+
+	fmt.Printf("Loaded %d movies from TMDB export %s\n", idx.count, path)
+	return idx, nil
+}
+
+func (idx *TMDBExportIndex) Len() int {
+	return idx.count
+}
+
+// Match looks up every title variation in the export and returns the best
+// scoring match, or nil when no variation is present.
+func (idx *TMDBExportIndex) Match(title string, year int, director string) *TMDBMatch {
+	var best *TMDBMatch
+	for _, variation := range cleanTitle(title) {
+		entries := idx.byTitle[normalizeTitle(variation)]
+		if len(entries) == 0 {
+			continue
+		}
+
+		e := entries[0]
+		match := scoreCandidate(variation, year, director, TMDBMovie{ID: e.ID, OriginalTitle: e.OriginalTitle}, nil, nil)
+		match.Strategy = StrategyOfflineExport
+		if len(entries) > 1 {
+			match.Confidence *= exportAmbiguityPenalty
+			match.Reason += fmt.Sprintf(", ambiguous: %d export entries", len(entries))
+		}
+
+		if best == nil || match.Confidence > best.Confidence {
+			best = &match
+		}
+	}
+	return best
+}
@@ -0,0 +1,67 @@
+package metrograph
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Prefixes of a film's stable identifier, strongest first
+const (
+	filmIDPrefixVista = "vista-"
+	filmIDPrefixURL   = "url-"
+	filmIDPrefixTMDB  = "tmdb-"
+	filmIDPrefixTitle = "title-"
+)
+
+// StableID identifies a film across crawls. It comes from the Metrograph vista
+// film ID, then the film page URL. Films with neither, such as those in
+// snapshots written before film pages were scraped, fall back to their TMDB
+// ID, which changes whenever the film is matched again, and unmatched ones to
+// their normalized title and year. A film with none of these has no ID.
+func (f Film) StableID() string {
+	if f.ID != "" {
+		return f.ID
+	}
+	return f.deriveID()
+}
+
+func (f Film) deriveID() string {
+	if f.MetrographID != "" {
+		return filmIDPrefixVista + f.MetrographID
+	}
+	if f.MetrographURL != "" {
+		if id := extractFilmID(f.MetrographURL); id != "" {
+			return filmIDPrefixVista + id
+		}
+		if u, err := url.Parse(f.MetrographURL); err == nil {
+			if slug := strings.Trim(u.Path, "/"); slug != "" {
+				return filmIDPrefixURL + strings.ReplaceAll(slug, "/", "-")
+			}
+		}
+	}
+	if f.TMDBID > 0 {
+		return fmt.Sprintf("%s%d", filmIDPrefixTMDB, f.TMDBID)
+	}
+	if title := normalizeTitle(f.Title); title != "" {
+		id := filmIDPrefixTitle + strings.ReplaceAll(title, " ", "-")
+		if f.Year > 0 {
+			id += fmt.Sprintf("-%d", f.Year)
+		}
+		return id
+	}
+	return ""
+}
+
+// assignFilmIDs sets ID on every film that does not have one yet, or whose ID
+// was only a title or TMDB fallback and can now be derived from Metrograph.
+func assignFilmIDs(results map[string]Series) {
+	for _, s := range results {
+		for i := range s.Movies {
+			f := &s.Movies[i]
+			if f.ID == "" || strings.HasPrefix(f.ID, filmIDPrefixTitle) || strings.HasPrefix(f.ID, filmIDPrefixTMDB) {
+				f.ID = f.deriveID()
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package metrograph
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FilmMetadata is the structured form of a film's ".film-metadata" line.
+type FilmMetadata struct {
+	Directors []string `json:"directors,omitempty"`
+	Year      int      `json:"year,omitempty"`
+	Countries []string `json:"countries,omitempty"`
+	Runtime   int      `json:"runtime,omitempty"` // minutes
+	Languages []string `json:"languages,omitempty"`
+	Formats   []string `json:"formats,omitempty"`
+	Unparsed  []string `json:"unparsed,omitempty"`
+}
+
+var (
+	metadataSeparatorRe  = regexp.MustCompile(`\s*(?:/|\||•|·|\n)\s*`)
+	metadataYearRe       = regexp.MustCompile(`^(1[89]\d\d|20\d\d)$`)
+	metadataRuntimeRe    = regexp.MustCompile(`(?i)^(?:(\d+)\s*h(?:rs?|ours?)?\.?\s*)?(?:(\d+)\s*(?:m|mins?|minutes?)\.?)?$`)
+	metadataLanguageRe   = regexp.MustCompile(`(?i)^in\s+(.+?)(?:\s+with\s+.+\s+subtitles)?$`)
+	metadataListRe       = regexp.MustCompile(`\s*(?:,|&|\band\b)\s*`)
+	metadataFormatRe     = regexp.MustCompile(`(?i)\b(35\s?mm|16\s?mm|70\s?mm|65\s?mm|super\s?8|8\s?mm|4k\s+dcp|2k\s+dcp|dcp|4k|digital|vhs|betacam|blu-ray|nitrate)\b`)
+	metadataFormatWordRe = regexp.MustCompile(`(?i)\b(?:new|restoration|restored|remastered|print|projection|presented|in)\b`)
+	metadataDirectorRe   = regexp.MustCompile(`(?i)^(?:dir\.|dirs\.|directed\s+by|director:?|directors:?)\s*`)
+)
+
+// metadataCountries holds lower-cased country names as they appear in
+// Metrograph listings.
+var metadataCountries = map[string]bool{}
+
+func init() {
+	for _, c := range []string{
+		"USA", "US", "UK", "France", "Italy", "Japan", "Germany", "West Germany",
+		"East Germany", "Spain", "Portugal", "Mexico", "Brazil", "Argentina",
+		"Chile", "Cuba", "Canada", "Soviet Union", "USSR", "Russia", "Poland",
+		"Czechoslovakia", "Czech Republic", "Hungary", "Yugoslavia", "Romania",
+		"Greece", "Turkey", "Iran", "India", "China", "Hong Kong", "Taiwan",
+		"South Korea", "Korea", "Thailand", "Philippines", "Indonesia",
+		"Australia", "New Zealand", "Sweden", "Denmark", "Norway", "Finland",
+		"Iceland", "Belgium", "Netherlands", "Switzerland", "Austria", "Ireland",
+		"Senegal", "Mali", "Egypt", "Nigeria", "South Africa", "Israel",
+		"Lebanon", "Georgia", "Ukraine", "Colombia", "Peru", "Venezuela",
+	} {
+		metadataCountries[strings.ToLower(c)] = true
+	}
+}
+
+// ParseFilmMetadata parses a Metrograph metadata line. Tokens are split on
+// "/", "|", "•", "·" and newlines and classified by shape. Samples:
+//
+//	"Todd Haynes / 2015 / 118min / DCP"
+//	    -> Directors [Todd Haynes], Year 2015, Runtime 118, Formats [DCP]
+//	"Jean-Marie Straub, Danièle Huillet / 1975 / 35mm"
+//	    -> Directors [Jean-Marie Straub, Danièle Huillet], Year 1975, Formats [35mm]
+//	"1982 / 86 min."
+//	    -> Year 1982, Runtime 86
+//	"Agnès Varda • France • 1962 • 90 mins • In French with English subtitles"
+//	    -> Directors [Agnès Varda], Countries [France], Year 1962, Runtime 90, Languages [French]
+//	"1917 / Sam Mendes / 2019 / 1h 59m / 4K DCP" for the film "1917"
+//	    -> Directors [Sam Mendes], Year 2019, Runtime 119, Formats [4K DCP]
+//	"Dir. Chantal Akerman / 1975 / 201 min / 4K restoration"
+//	    -> Directors [Chantal Akerman], Year 1975, Runtime 201, Formats [4K]
+//
+// The film title is passed so a year-titled film ("1917", "2046") repeated
+// in its own metadata is not mistaken for the release year.
+func ParseFilmMetadata(title string, raw string) FilmMetadata {
+	var md FilmMetadata
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return md
+	}
+
+	title = strings.TrimSpace(title)
+	var years []int
+	sawYear := false
+	for _, token := range metadataSeparatorRe.Split(raw, -1) {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+
+		if metadataYearRe.MatchString(token) {
+			yr, _ := strconv.Atoi(token)
+			if token == title {
+				// Keep it as a last resort in case it really is the year
+				years = append(years, -yr)
+			} else {
+				years = append(years, yr)
+				sawYear = true
+			}
+			continue
+		}
+
+		if minutes, ok := parseRuntime(token); ok {
+			md.Runtime = minutes
+			continue
+		}
+
+		if m := metadataLanguageRe.FindStringSubmatch(token); m != nil {
+			md.Languages = append(md.Languages, splitMetadataList(m[1])...)
+			continue
+		}
+
+		if formats := metadataFormatRe.FindAllString(token, -1); formats != nil && isFormatToken(token, formats) {
+			md.Formats = append(md.Formats, formats...)
+			continue
+		}
+
+		if countries := splitMetadataList(token); allCountries(countries) {
+			md.Countries = append(md.Countries, countries...)
+			continue
+		}
+
+		// The first free-text token before any year is the director credit
+		if md.Directors == nil && !sawYear {
+			md.Directors = splitMetadataList(metadataDirectorRe.ReplaceAllString(token, ""))
+			continue
+		}
+
+		md.Unparsed = append(md.Unparsed, token)
+	}
+
+	for _, yr := range years {
+		if yr > 0 {
+			md.Year = yr
+			break
+		}
+	}
+	if md.Year == 0 && len(years) > 0 {
+		md.Year = -years[0]
+	}
+
+	return md
+}
+
+func parseRuntime(token string) (int, bool) {
+	m := metadataRuntimeRe.FindStringSubmatch(strings.TrimSpace(token))
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return 0, false
+	}
+
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	return hours*60 + minutes, true
+}
+
+// isFormatToken reports whether token is only format names, with words like
+// "restoration" or "print" around them, so titles or credits that merely
+// mention "digital" are not swallowed.
+func isFormatToken(token string, formats []string) bool {
+	rest := token
+	for _, f := range formats {
+		rest = strings.Replace(rest, f, "", 1)
+	}
+	rest = metadataFormatWordRe.ReplaceAllString(rest, "")
+	return strings.Trim(rest, " ,&+-") == ""
+}
+
+func splitMetadataList(token string) []string {
+	var items []string
+	for _, item := range metadataListRe.Split(token, -1) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func allCountries(items []string) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if !metadataCountries[strings.ToLower(item)] {
+			return false
+		}
+	}
+	return true
+}
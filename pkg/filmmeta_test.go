@@ -0,0 +1,81 @@
+package metrograph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFilmMetadata(t *testing.T) {
+	tests := []struct {
+		title string
+		raw   string
+		want  FilmMetadata
+	}{
+		{
+			title: "Carol",
+			raw:   "Todd Haynes / 2015 / 118min / DCP",
+			want:  FilmMetadata{Directors: []string{"Todd Haynes"}, Year: 2015, Runtime: 118, Formats: []string{"DCP"}},
+		},
+		{
+			title: "Moses and Aaron",
+			raw:   "Jean-Marie Straub, Danièle Huillet / 1975 / 35mm",
+			want:  FilmMetadata{Directors: []string{"Jean-Marie Straub", "Danièle Huillet"}, Year: 1975, Formats: []string{"35mm"}},
+		},
+		{
+			title: "Koyaanisqatsi",
+			raw:   "1982 / 86 min.",
+			want:  FilmMetadata{Year: 1982, Runtime: 86},
+		},
+		{
+			title: "Cléo from 5 to 7",
+			raw:   "Agnès Varda • France • 1962 • 90 mins • In French with English subtitles",
+			want: FilmMetadata{
+				Directors: []string{"Agnès Varda"},
+				Countries: []string{"France"},
+				Year:      1962,
+				Runtime:   90,
+				Languages: []string{"French"},
+			},
+		},
+		{
+			title: "1917",
+			raw:   "1917 / Sam Mendes / 2019 / 1h 59m / 4K DCP",
+			want:  FilmMetadata{Directors: []string{"Sam Mendes"}, Year: 2019, Runtime: 119, Formats: []string{"4K DCP"}},
+		},
+		{
+			title: "2046",
+			raw:   "2046 / Wong Kar-wai / 2004 / 129min / 35mm",
+			want:  FilmMetadata{Directors: []string{"Wong Kar-wai"}, Year: 2004, Runtime: 129, Formats: []string{"35mm"}},
+		},
+		{
+			title: "Jeanne Dielman, 23 quai du Commerce, 1080 Bruxelles",
+			raw:   "Dir. Chantal Akerman / 1975 / 201 min / 4K restoration",
+			want:  FilmMetadata{Directors: []string{"Chantal Akerman"}, Year: 1975, Runtime: 201, Formats: []string{"4K"}},
+		},
+		{
+			title: "Daisies",
+			raw:   "Directed by Věra Chytilová | Czechoslovakia | 1966 | 76 min | New 35mm print",
+			want: FilmMetadata{
+				Directors: []string{"Věra Chytilová"},
+				Countries: []string{"Czechoslovakia"},
+				Year:      1966,
+				Runtime:   76,
+				Formats:   []string{"35mm"},
+			},
+		},
+		{
+			title: "Empty",
+			raw:   "  ",
+			want:  FilmMetadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			got := ParseFilmMetadata(tt.title, tt.raw)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilmMetadata(%q, %q)\n got: %+v\nwant: %+v", tt.title, tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package metrograph
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// Screening is one showtime listed on a Metrograph film page.
+type Screening struct {
+	Start     time.Time `json:"start"`
+	TicketURL string    `json:"ticket_url,omitempty"`
+}
+
+// filmPage holds what we scrape from a single film page.
+type filmPage struct {
+	Synopsis   string
+	Metadata   string
+	Screenings []Screening
+}
+
+var (
+	weekdayPrefixRe = regexp.MustCompile(`(?i)^(mon|tue|wed|thu|fri|sat|sun)[a-z]*\.?,?\s+`)
+	showtimeSpaceRe = regexp.MustCompile(`\s+`)
+)
+
+var (
+	showtimeDateLayouts = []string{"January 2 2006", "Jan 2 2006", "January 2", "Jan 2", "1/2/2006", "1/2"}
+	showtimeTimeLayouts = []string{"3:04pm", "3:04 pm", "3pm", "3 pm", "15:04"}
+)
+
+func metrographLocation() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+func absoluteURL(href string) string {
+	if href == "" || strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+		return href
+	}
+	if !strings.HasPrefix(href, "/") {
+		href = "/" + href
+	}
+	return BASE + href
+}
+
+// extractFilmID returns the vista film ID from a Metrograph film URL.
+func extractFilmID(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("vista_film_id")
+}
+
+// parseDay parses a day heading such as "Friday January 3". Headings
+// usually omit the year, so it is picked to place the day between two
+// months ago and ten months ahead of now.
+func parseDay(day string, now time.Time) (time.Time, bool) {
+	loc := metrographLocation()
+
+	day = strings.TrimSpace(weekdayPrefixRe.ReplaceAllString(strings.TrimSpace(day), ""))
+	day = showtimeSpaceRe.ReplaceAllString(strings.ReplaceAll(day, ",", ""), " ")
+
+	for _, dl := range showtimeDateLayouts {
+		d, err := time.ParseInLocation(dl, day, loc)
+		if err != nil {
+			continue
+		}
+
+		year := d.Year()
+		if year == 0 {
+			year = now.Year()
+			candidate := time.Date(year, d.Month(), d.Day(), 0, 0, 0, 0, loc)
+			switch {
+			case candidate.Before(now.AddDate(0, -2, 0)):
+				year++
+			case candidate.After(now.AddDate(0, 10, 0)):
+				year--
+			}
+		}
+		return time.Date(year, d.Month(), d.Day(), 0, 0, 0, 0, loc), true
+	}
+
+	return time.Time{}, false
+}
+
+// parseShowtime combines a day heading such as "Friday January 3" with a
+// time such as "7:00pm".
+func parseShowtime(day, clock string, now time.Time) (time.Time, bool) {
+	d, ok := parseDay(day, now)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	clock = strings.ToLower(strings.TrimSpace(clock))
+	for _, tl := range showtimeTimeLayouts {
+		t, err := time.ParseInLocation(tl, clock, d.Location())
+		if err != nil {
+			continue
+		}
+		return time.Date(d.Year(), d.Month(), d.Day(), t.Hour(), t.Minute(), 0, 0, d.Location()), true
+	}
+
+	return time.Time{}, false
+}
+
+// filmPages holds scraped film pages keyed by the URL they were requested
+// with. Each page is only written by its own response's callbacks, but the
+// map is shared by all of them.
+type filmPages struct {
+	mu    sync.Mutex
+	pages map[string]*filmPage
+}
+
+// get returns the page for key, creating it if needed. The bool reports
+// whether it already existed.
+func (fp *filmPages) get(key string) (*filmPage, bool) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	p, ok := fp.pages[key]
+	if !ok {
+		p = &filmPage{}
+		fp.pages[key] = p
+	}
+	return p, ok
+}
+
+// newFilmPageCollector returns a collector that stores every scraped film
+// page in pages.
+func newFilmPageCollector(c *colly.Collector, sel Selectors, pages *filmPages) *colly.Collector {
+	fc := c.Clone()
+	now := time.Now()
+
+	page := func(r *colly.Request) *filmPage {
+		p, _ := pages.get(r.Ctx.Get("film_url"))
+		return p
+	}
+
+	fc.OnHTML(sel.FilmPageSynopsis, func(h *colly.HTMLElement) {
+		p := page(h.Request)
+		if p.Synopsis == "" {
+			p.Synopsis = strings.TrimSpace(h.Text)
+		}
+	})
+
+	fc.OnHTML(sel.FilmPageMetadata, func(h *colly.HTMLElement) {
+		p := page(h.Request)
+		if p.Metadata == "" {
+			p.Metadata = strings.TrimSpace(h.Text)
+		}
+	})
+
+	fc.OnHTML(sel.FilmPageDay, func(h *colly.HTMLElement) {
+		p := page(h.Request)
+		day := h.ChildText(sel.FilmPageDate)
+		h.ForEach(sel.FilmPageTime, func(_ int, a *colly.HTMLElement) {
+			start, ok := parseShowtime(day, a.Text, now)
+			if !ok {
+				fmt.Printf("Could not parse showtime %q %q\n", day, a.Text)
+				return
+			}
+			p.Screenings = append(p.Screenings, Screening{
+				Start:     start,
+				TicketURL: absoluteURL(a.Attr("href")),
+			})
+		})
+	})
+
+	return fc
+}
+
+// scrapeFilmPages visits the Metrograph page of every film that has one and
+// copies showtimes, synopsis, runtime and format onto the films.
+func scrapeFilmPages(c *colly.Collector, sel Selectors, results map[string]Series) {
+	pages := &filmPages{pages: make(map[string]*filmPage)}
+	fc := newFilmPageCollector(c, sel, pages)
+
+	for _, s := range results {
+		for _, f := range s.Movies {
+			if f.MetrographURL == "" {
+				continue
+			}
+			if _, ok := pages.get(f.MetrographURL); ok {
+				continue
+			}
+
+			ctx := colly.NewContext()
+			ctx.Put("film_url", f.MetrographURL)
+			if err := fc.Request("GET", f.MetrographURL, nil, ctx, nil); err != nil {
+				fmt.Printf("Failed to visit film page %s: %v\n", f.MetrographURL, err)
+			}
+		}
+	}
+	fc.Wait()
+
+	for _, s := range results {
+		for i := range s.Movies {
+			f := &s.Movies[i]
+			p, ok := pages.pages[f.MetrographURL]
+			if !ok {
+				continue
+			}
+
+			f.Synopsis = p.Synopsis
+			f.Screenings = p.Screenings
+			if p.Metadata != "" {
+				f.mergeMetadata(ParseFilmMetadata(f.Title, p.Metadata))
+			}
+		}
+	}
+}
+
+// mergeMetadata fills fields the series page left empty from the richer
+// metadata on the film page.
+func (f *Film) mergeMetadata(md FilmMetadata) {
+	if f.Metadata == nil {
+		f.Metadata = &md
+	} else {
+		if f.Metadata.Runtime == 0 {
+			f.Metadata.Runtime = md.Runtime
+		}
+		if len(f.Metadata.Formats) == 0 {
+			f.Metadata.Formats = md.Formats
+		}
+		if len(f.Metadata.Countries) == 0 {
+			f.Metadata.Countries = md.Countries
+		}
+		if len(f.Metadata.Languages) == 0 {
+			f.Metadata.Languages = md.Languages
+		}
+		if len(f.Metadata.Directors) == 0 {
+			f.Metadata.Directors = md.Directors
+		}
+		if f.Metadata.Year == 0 {
+			f.Metadata.Year = md.Year
+		}
+	}
+
+	if f.Director == "" {
+		f.Director = strings.Join(f.Metadata.Directors, ", ")
+	}
+	if f.Year == 0 {
+		f.Year = f.Metadata.Year
+	}
+}
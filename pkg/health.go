@@ -0,0 +1,121 @@
+package metrograph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultHealthMinSeries        = 1
+	defaultHealthMinFilms         = 5
+	defaultHealthMinFilmURLRatio  = 0.5
+	defaultHealthMaxEmptyRatio    = 0.5
+	healthMaxListedMissingEntries = 5
+)
+
+// HealthThresholds decides when a crawl looks like the site changed under the
+// selectors. Zero values fall back to the defaults above; a negative value
+// disables that check.
+type HealthThresholds struct {
+	MinSeries          int     `yaml:"min_series"`
+	MinFilms           int     `yaml:"min_films"`             // Across all series
+	MinFilmURLRatio    float64 `yaml:"min_film_url_ratio"`    // Share of films linking to a film page
+	MaxEmptySeriesRate float64 `yaml:"max_empty_series_rate"` // Share of series with no films
+}
+
+// CrawlHealthError lists everything that failed the post-crawl health check.
+type CrawlHealthError struct {
+	Problems []string
+}
+
+func (e *CrawlHealthError) Error() string {
+	return fmt.Sprintf("crawl health check failed, the Metrograph site or the configured selectors may have changed:\n  - %s",
+		strings.Join(e.Problems, "\n  - "))
+}
+
+func (t HealthThresholds) withDefaults() HealthThresholds {
+	if t.MinSeries == 0 {
+		t.MinSeries = defaultHealthMinSeries
+	}
+	if t.MinFilms == 0 {
+		t.MinFilms = defaultHealthMinFilms
+	}
+	if t.MinFilmURLRatio == 0 {
+		t.MinFilmURLRatio = defaultHealthMinFilmURLRatio
+	}
+	if t.MaxEmptySeriesRate == 0 {
+		t.MaxEmptySeriesRate = defaultHealthMaxEmptyRatio
+	}
+	return t
+}
+
+// CheckCrawlHealth returns a *CrawlHealthError when the crawl found too little
+// or left required fields empty. untitled counts, by series ID, the films the
+// crawl dropped because their title was empty.
+func CheckCrawlHealth(results map[string]Series, untitled map[string]int, thresholds HealthThresholds) error {
+	t := thresholds.withDefaults()
+	var problems []string
+
+	films, withURL, empty := 0, 0, 0
+	var unnamed []string
+	for id, s := range results {
+		if strings.TrimSpace(s.Name) == "" {
+			unnamed = append(unnamed, id)
+		}
+		if len(s.Movies) == 0 {
+			empty++
+		}
+		for _, f := range s.Movies {
+			films++
+			if f.MetrographURL != "" {
+				withURL++
+			}
+		}
+	}
+
+	var untitledSeries []string
+	for id, n := range untitled {
+		if n > 0 {
+			untitledSeries = append(untitledSeries, fmt.Sprintf("%d in %s", n, id))
+		}
+	}
+
+	fmt.Printf("Crawl health: %d series, %d films, %d with film pages, %d empty series\n", len(results), films, withURL, empty)
+
+	if t.MinSeries > 0 && len(results) < t.MinSeries {
+		problems = append(problems, fmt.Sprintf("found %d series, expected at least %d (selectors.series_row / series_link)", len(results), t.MinSeries))
+	}
+	if t.MinFilms > 0 && films < t.MinFilms {
+		problems = append(problems, fmt.Sprintf("found %d films, expected at least %d (selectors.film)", films, t.MinFilms))
+	}
+	if t.MinFilmURLRatio > 0 && films > 0 {
+		if ratio := float64(withURL) / float64(films); ratio < t.MinFilmURLRatio {
+			problems = append(problems, fmt.Sprintf("only %.0f%% of films link to a film page, expected at least %.0f%% (selectors.film_link)", ratio*100, t.MinFilmURLRatio*100))
+		}
+	}
+	if t.MaxEmptySeriesRate > 0 && len(results) > 0 {
+		if ratio := float64(empty) / float64(len(results)); ratio > t.MaxEmptySeriesRate {
+			problems = append(problems, fmt.Sprintf("%.0f%% of series have no films, expected at most %.0f%% (selectors.film)", ratio*100, t.MaxEmptySeriesRate*100))
+		}
+	}
+	if len(unnamed) > 0 {
+		problems = append(problems, "series without a name: "+listSome(unnamed))
+	}
+	if len(untitledSeries) > 0 {
+		problems = append(problems, "films without a title (selectors.film_title): "+listSome(untitledSeries))
+	}
+
+	if len(problems) > 0 {
+		return &CrawlHealthError{Problems: problems}
+	}
+	return nil
+}
+
+func listSome(items []string) string {
+	sort.Strings(items)
+	if len(items) <= healthMaxListedMissingEntries {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:healthMaxListedMissingEntries], ", "), len(items)-healthMaxListedMissingEntries)
+}
@@ -0,0 +1,214 @@
+package metrograph
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultHTTPCacheMaxAge = time.Hour
+
+// ErrNotCached is returned in offline mode for pages missing from the cache.
+var ErrNotCached = errors.New("page not in HTTP cache")
+
+// httpCacheEntry is one cached page, stored as <sha1 of URL>.json.
+type httpCacheEntry struct {
+	URL          string      `json:"url"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	FetchedAt    time.Time   `json:"fetched_at"`
+}
+
+type HTTPCacheStats struct {
+	Fresh       int // Served without contacting Metrograph
+	Revalidated int // Conditional request answered with 304 Not Modified
+	Fetched     int // Downloaded in full
+	Missed      int // Not cached in offline mode
+}
+
+// HTTPCache is an http.RoundTripper that keeps Metrograph pages on disk.
+// Pages younger than maxAge are served as is; older ones are revalidated
+// with If-None-Match / If-Modified-Since. In offline mode nothing is sent
+// and every page must come from the cache.
+type HTTPCache struct {
+	dir     string
+	maxAge  time.Duration
+	offline bool
+	next    http.RoundTripper
+
+	mu    sync.Mutex
+	stats HTTPCacheStats
+}
+
+// NewHTTPCache returns a cache in dir, creating it if needed. A zero maxAge
+// falls back to the default; a negative one revalidates every request.
+func NewHTTPCache(dir string, maxAge time.Duration, offline bool) (*HTTPCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create HTTP cache directory %s: %w", dir, err)
+	}
+	if maxAge == 0 {
+		maxAge = defaultHTTPCacheMaxAge
+	}
+
+	return &HTTPCache{
+		dir:     dir,
+		maxAge:  maxAge,
+		offline: offline,
+		next:    http.DefaultTransport,
+	}, nil
+}
+
+func (c *HTTPCache) path(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *HTTPCache) load(url string) (*httpCacheEntry, bool) {
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil, false
+	}
+
+	var e httpCacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return nil, false
+	}
+	return &e, true
+}
+
+func (c *HTTPCache) store(e *httpCacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path(e.URL) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(e.URL))
+}
+
+func (c *HTTPCache) count(field *int) {
+	c.mu.Lock()
+	*field++
+	c.mu.Unlock()
+}
+
+func (e *httpCacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func (c *HTTPCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if c.offline {
+			return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrNotCached)
+		}
+		return c.next.RoundTrip(req)
+	}
+
+	url := req.URL.String()
+	cached, ok := c.load(url)
+
+	if c.offline {
+		if !ok {
+			c.count(&c.stats.Missed)
+			return nil, fmt.Errorf("%s: %w", url, ErrNotCached)
+		}
+		c.count(&c.stats.Fresh)
+		return cached.response(req), nil
+	}
+
+	if ok && c.maxAge > 0 && time.Since(cached.FetchedAt) < c.maxAge {
+		c.count(&c.stats.Fresh)
+		return cached.response(req), nil
+	}
+
+	if ok {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		cached.FetchedAt = time.Now()
+		if err := c.store(cached); err != nil {
+			fmt.Printf("Warning: failed to update HTTP cache for %s: %v\n", url, err)
+		}
+		c.count(&c.stats.Revalidated)
+		return cached.response(req), nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	c.count(&c.stats.Fetched)
+
+	// Only successful pages are worth replaying
+	if resp.StatusCode == http.StatusOK {
+		e := &httpCacheEntry{
+			URL:          url,
+			StatusCode:   resp.StatusCode,
+			Header:       resp.Header.Clone(),
+			Body:         body,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+		}
+		if err := c.store(e); err != nil {
+			fmt.Printf("Warning: failed to write HTTP cache for %s: %v\n", url, err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *HTTPCache) Stats() HTTPCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *HTTPCache) PrintStats() {
+	s := c.Stats()
+	fmt.Printf("HTTP cache: %d fresh, %d revalidated, %d fetched", s.Fresh, s.Revalidated, s.Fetched)
+	if c.offline {
+		fmt.Printf(", %d missing (offline)", s.Missed)
+	}
+	fmt.Println()
+}
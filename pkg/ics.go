@@ -0,0 +1,209 @@
+package metrograph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	icsLocation        = "Metrograph, 7 Ludlow St, New York, NY 10002"
+	icsDefaultDuration = 2 * time.Hour
+	icsTimeLayout      = "20060102T150405Z"
+	icsMaxLineOctets   = 75
+)
+
+// icsEvent is one screening, possibly listed in several series.
+type icsEvent struct {
+	uid        string
+	film       Film
+	screening  Screening
+	categories []string
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsUID is stable across crawls for the same screening so calendar clients
+// replace the event instead of duplicating it.
+func icsUID(f Film, s Screening) string {
+	return fmt.Sprintf("%s-%s@metrograph-watchlist", f.StableID(), s.Start.UTC().Format("20060102T1504"))
+}
+
+func (f Film) runtimeMinutes() int {
+	if f.Metadata != nil && f.Metadata.Runtime > 0 {
+		return f.Metadata.Runtime
+	}
+	return f.Runtime
+}
+
+func icsDescription(f Film, categories []string) string {
+	var lines []string
+
+	var credit []string
+	if f.Director != "" {
+		credit = append(credit, f.Director)
+	}
+	if f.Year > 0 {
+		credit = append(credit, fmt.Sprintf("%d", f.Year))
+	}
+	if len(credit) > 0 {
+		lines = append(lines, strings.Join(credit, ", "))
+	}
+	if f.Metadata != nil && len(f.Metadata.Formats) > 0 {
+		lines = append(lines, "Format: "+strings.Join(f.Metadata.Formats, ", "))
+	}
+	lines = append(lines, "Series: "+strings.Join(categories, ", "))
+	if f.Synopsis != "" {
+		lines = append(lines, "", f.Synopsis)
+	}
+	if f.MetrographURL != "" {
+		lines = append(lines, "", f.MetrographURL)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// icsWriter writes content lines folded at 75 octets with CRLF endings.
+type icsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icsWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+
+	s := name + ":" + value
+	limit := icsMaxLineOctets
+	for len(s) > limit {
+		// Do not split a multi-byte rune across lines
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		_, iw.err = iw.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = icsMaxLineOctets - 1
+	}
+	_, err := iw.w.WriteString(s + "\r\n")
+	if iw.err == nil {
+		iw.err = err
+	}
+}
+
+// WriteICS writes one VEVENT per screening in data. When seriesIDs is not
+// empty only those series are included. It returns the number of events.
+func WriteICS(w io.Writer, data ScrapedData, seriesIDs []string) (int, error) {
+	wanted := make(map[string]bool)
+	for _, id := range seriesIDs {
+		wanted[id] = true
+	}
+
+	events := make(map[string]*icsEvent)
+	for seriesID, s := range data.Collections {
+		if len(wanted) > 0 && !wanted[seriesID] {
+			continue
+		}
+		for _, f := range s.Movies {
+			if f.Ignored {
+				continue
+			}
+			for _, sc := range f.Screenings {
+				uid := icsUID(f, sc)
+				ev, ok := events[uid]
+				if !ok {
+					ev = &icsEvent{uid: uid, film: f, screening: sc}
+					events[uid] = ev
+				}
+				ev.categories = append(ev.categories, s.Name)
+			}
+		}
+	}
+
+	sorted := make([]*icsEvent, 0, len(events))
+	for _, ev := range events {
+		sort.Strings(ev.categories)
+		sorted = append(sorted, ev)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].screening.Start.Equal(sorted[j].screening.Start) {
+			return sorted[i].screening.Start.Before(sorted[j].screening.Start)
+		}
+		return sorted[i].uid < sorted[j].uid
+	})
+
+	iw := &icsWriter{w: bufio.NewWriter(w)}
+	stamp := time.Now().UTC().Format(icsTimeLayout)
+
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//metrograph-watchlist//Screenings//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("X-WR-CALNAME", "Metrograph Screenings")
+	iw.line("X-WR-TIMEZONE", "America/New_York")
+
+	for _, ev := range sorted {
+		duration := icsDefaultDuration
+		if rt := ev.film.runtimeMinutes(); rt > 0 {
+			duration = time.Duration(rt) * time.Minute
+		}
+		start := ev.screening.Start.UTC()
+
+		iw.line("BEGIN", "VEVENT")
+		iw.line("UID", ev.uid)
+		iw.line("DTSTAMP", stamp)
+		iw.line("DTSTART", start.Format(icsTimeLayout))
+		iw.line("DTEND", start.Add(duration).Format(icsTimeLayout))
+		iw.line("SUMMARY", icsTextEscaper.Replace(ev.film.Title))
+		iw.line("DESCRIPTION", icsTextEscaper.Replace(icsDescription(ev.film, ev.categories)))
+		iw.line("LOCATION", icsTextEscaper.Replace(icsLocation))
+
+		categories := make([]string, len(ev.categories))
+		for i, c := range ev.categories {
+			categories[i] = icsTextEscaper.Replace(c)
+		}
+		iw.line("CATEGORIES", strings.Join(categories, ","))
+
+		if ev.screening.TicketURL != "" {
+			iw.line("URL", ev.screening.TicketURL)
+		} else if ev.film.MetrographURL != "" {
+			iw.line("URL", ev.film.MetrographURL)
+		}
+		iw.line("END", "VEVENT")
+	}
+
+	iw.line("END", "VCALENDAR")
+	if iw.err != nil {
+		return 0, iw.err
+	}
+	return len(sorted), iw.w.Flush()
+}
+
+// ExportICS writes the screenings in a snapshot loaded from source to
+// outFile, or to stdout when outFile is "-".
+func ExportICS(scrapedData ScrapedData, source string, outFile string, seriesIDs []string) error {
+	if outFile == "-" {
+		_, err := WriteICS(os.Stdout, scrapedData, seriesIDs)
+		return err
+	}
+
+	f, err := os.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", outFile, err)
+	}
+	defer f.Close()
+
+	count, err := WriteICS(f, scrapedData, seriesIDs)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", outFile, err)
+	}
+
+	fmt.Printf("Wrote %d screenings from %s to %s\n", count, source, outFile)
+	return f.Close()
+}
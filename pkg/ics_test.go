@@ -0,0 +1,81 @@
+package metrograph
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSWriterFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		lines int
+	}{
+		{"short", "Carol", 1},
+		{"exactly 75 octets", strings.Repeat("a", icsMaxLineOctets-len("SUMMARY:")), 1},
+		{"76 octets", strings.Repeat("a", icsMaxLineOctets-len("SUMMARY:")+1), 2},
+		{"multi-byte", strings.Repeat("花樣年華 ", 12) + "Jeanne Dielman, 23 quai du Commerce, 1080 Bruxelles — Chantal Akerman", 4},
+		{"multi-byte at the fold", strings.Repeat("a", icsMaxLineOctets-len("SUMMARY:")-1) + strings.Repeat("é", 40), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			iw := &icsWriter{w: bufio.NewWriter(&buf)}
+			iw.line("SUMMARY", tt.value)
+			if err := iw.w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("output does not end in CRLF: %q", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			if len(lines) != tt.lines {
+				t.Errorf("got %d lines, want %d: %q", len(lines), tt.lines, lines)
+			}
+			for i, l := range lines {
+				if len(l) > icsMaxLineOctets {
+					t.Errorf("line %d is %d octets: %q", i+1, len(l), l)
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a multi-byte rune: %q", i+1, l)
+				}
+				if i > 0 && !strings.HasPrefix(l, " ") {
+					t.Errorf("continuation line %d does not start with a space: %q", i+1, l)
+				}
+			}
+
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != "SUMMARY:"+tt.value {
+				t.Errorf("unfolded line = %q, want %q", unfolded, "SUMMARY:"+tt.value)
+			}
+		})
+	}
+}
+
+func TestICSUIDStable(t *testing.T) {
+	start := time.Date(2026, time.January, 3, 19, 0, 0, 0, metrographLocation())
+	film := Film{MetrographID: "HO00012345", Title: "Carol", TMDBID: 258480, Confidence: 0.9}
+	uid := icsUID(film, Screening{Start: start})
+
+	if want := "vista-HO00012345-20260104T0000@metrograph-watchlist"; uid != want {
+		t.Errorf("uid = %q, want %q", uid, want)
+	}
+
+	rematched := film
+	rematched.TMDBID, rematched.Confidence = 1, 0.6
+	if got := icsUID(rematched, Screening{Start: start, TicketURL: "https://metrograph.com/tickets/1"}); got != uid {
+		t.Errorf("uid changed with the TMDB match or ticket URL: %q, want %q", got, uid)
+	}
+	if got := icsUID(film, Screening{Start: start.UTC()}); got != uid {
+		t.Errorf("uid changed with the time zone: %q, want %q", got, uid)
+	}
+	if got := icsUID(film, Screening{Start: start.Add(2 * time.Hour)}); got == uid {
+		t.Errorf("another screening of the film has the same uid %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package metrograph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Weights used when scoring a TMDB candidate against a scraped film. They
+// add up to 1 so a confidence can be read as a rough probability.
+const (
+	titleWeight    = 0.5
+	yearWeight     = 0.25
+	directorWeight = 0.25
+)
+
+// Search strategies recorded on a match, in the order SearchTMDB tries them.
+const (
+	StrategyExact            = "exact"
+	StrategyAdjacentYear     = "adjacent-year"
+	StrategyNoYear           = "no-year"
+	StrategyAlternativeTitle = "alternative-title"
+)
+
+// TMDBMatch is a scored TMDB candidate for a scraped film.
+type TMDBMatch struct {
+	Movie      TMDBMovie
+	Confidence float64
+	Reason     string
+	Strategy   string
+}
+
+// confidentMatch reports whether the film has a TMDB ID scored at or above
+// minConfidence. Films from snapshots written before scoring existed have no
+// confidence and are trusted as before.
+func (f Film) confidentMatch(minConfidence float64) bool {
+	if f.TMDBID <= 0 {
+		return false
+	}
+	return f.Confidence == 0 || f.Confidence >= minConfidence
+}
+
+// normalizeTitle lower-cases a title, strips accents and punctuation and
+// drops a leading article so "The Mother and the Whore" and
+// "Mother and the Whore, The" compare equal. Letters and digits of any
+// script are kept, so CJK and Cyrillic titles do not normalize to "".
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	s := strings.Join(strings.Fields(b.String()), " ")
+	for _, article := range []string{"the", "a", "an"} {
+		s = strings.TrimPrefix(s, article+" ")
+		s = strings.TrimSuffix(s, " "+article)
+	}
+	return s
+}
+
+// titleSimilarity returns 1 for identical normalized titles and falls
+// towards 0 as the edit distance grows.
+func titleSimilarity(a, b string) float64 {
+	a, b = normalizeTitle(a), normalizeTitle(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func releaseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	yr, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return yr
+}
+
+// sameDirector reports whether scraped names one of directors. Names that
+// normalize to "" never match, as they would be a substring of anything.
+func sameDirector(scraped string, directors []string) bool {
+	want := normalizeTitle(scraped)
+	if want == "" {
+		return false
+	}
+	for _, d := range directors {
+		got := normalizeTitle(d)
+		if got == "" {
+			continue
+		}
+		if got == want || strings.Contains(want, got) || strings.Contains(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreCandidate rates how well a TMDB result matches the scraped title,
+// year and director. Unknown year or director score half their weight so
+// films with sparse metadata are not pushed below the threshold on that
+// alone. directors is nil when credits were not fetched. The title is
+// compared against the TMDB title, original title and any altTitles.
+func scoreCandidate(title string, year int, director string, movie TMDBMovie, directors []string, altTitles []string) TMDBMatch {
+	var reasons []string
+
+	sim := titleSimilarity(title, movie.Title)
+	titleSource := "title"
+	if s := titleSimilarity(title, movie.OriginalTitle); s > sim {
+		sim, titleSource = s, "original title"
+	}
+	for _, alt := range altTitles {
+		if s := titleSimilarity(title, alt); s > sim {
+			sim, titleSource = s, fmt.Sprintf("alternative title %q", alt)
+		}
+	}
+	score := sim * titleWeight
+	reasons = append(reasons, fmt.Sprintf("%s %.2f", titleSource, sim))
+
+	candidateYear := releaseYear(movie.ReleaseDate)
+	switch {
+	case year == 0 || candidateYear == 0:
+		score += yearWeight / 2
+		reasons = append(reasons, "year unknown")
+	case year == candidateYear:
+		score += yearWeight
+		reasons = append(reasons, "year exact")
+	case year-candidateYear == 1 || candidateYear-year == 1:
+		score += yearWeight * 0.6
+		reasons = append(reasons, fmt.Sprintf("year %+d", candidateYear-year))
+	default:
+		reasons = append(reasons, fmt.Sprintf("year mismatch %d", candidateYear))
+	}
+
+	switch {
+	case director == "" || directors == nil:
+		score += directorWeight / 2
+		reasons = append(reasons, "director unknown")
+	case sameDirector(director, directors):
+		score += directorWeight
+		reasons = append(reasons, "director match")
+	default:
+		reasons = append(reasons, "director mismatch")
+	}
+
+	return TMDBMatch{
+		Movie:      movie,
+		Confidence: score,
+		Reason:     strings.Join(reasons, ", "),
+	}
+}
@@ -0,0 +1,144 @@
+package metrograph
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Mother and the Whore", "mother and the whore"},
+		{"Mother and the Whore, The", "mother and the whore"},
+		{"A Man Escaped", "man escaped"},
+		{"An Autumn Afternoon", "autumn afternoon"},
+		{"Cléo de 5 à 7", "cleo de 5 a 7"},
+		{"Carol [4K DCP]", "carol 4k dcp"},
+		{"  Daisies!  ", "daisies"},
+		{"花樣年華", "花樣年華"},
+		{"Иди и смотри", "иди и смотри"},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := normalizeTitle(tt.title); got != tt.want {
+				t.Errorf("normalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreCandidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		title     string
+		year      int
+		director  string
+		movie     TMDBMovie
+		directors []string
+		altTitles []string
+		want      float64
+	}{
+		{
+			name:      "everything matches",
+			title:     "Carol",
+			year:      2015,
+			director:  "Todd Haynes",
+			movie:     TMDBMovie{Title: "Carol", ReleaseDate: "2015-11-20"},
+			directors: []string{"Todd Haynes"},
+			want:      1,
+		},
+		{
+			name:  "year and director unknown score half",
+			title: "Carol",
+			movie: TMDBMovie{Title: "Carol", ReleaseDate: "2015-11-20"},
+			want:  titleWeight + yearWeight/2 + directorWeight/2,
+		},
+		{
+			name:      "adjacent year and director mismatch",
+			title:     "Carol",
+			year:      2016,
+			director:  "Todd Haynes",
+			movie:     TMDBMovie{Title: "Carol", ReleaseDate: "2015-11-20"},
+			directors: []string{"Someone Else"},
+			want:      titleWeight + yearWeight*0.6,
+		},
+		{
+			name:      "year mismatch",
+			title:     "Hamlet",
+			year:      1948,
+			director:  "Laurence Olivier",
+			movie:     TMDBMovie{Title: "Hamlet", ReleaseDate: "1996-12-25"},
+			directors: []string{"Kenneth Branagh"},
+			want:      titleWeight,
+		},
+		{
+			name:      "close title",
+			title:     "Carrol",
+			year:      2015,
+			director:  "Todd Haynes",
+			movie:     TMDBMovie{Title: "Carol", ReleaseDate: "2015-11-20"},
+			directors: []string{"Todd Haynes"},
+			want:      titleWeight*5/6 + yearWeight + directorWeight,
+		},
+		{
+			name:      "original title in another script",
+			title:     "花樣年華",
+			year:      2000,
+			director:  "王家衛",
+			movie:     TMDBMovie{Title: "In the Mood for Love", OriginalTitle: "花樣年華", ReleaseDate: "2000-09-29"},
+			directors: []string{"Wong Kar-wai"},
+			want:      titleWeight + yearWeight,
+		},
+		{
+			name:      "alternative title",
+			title:     "Cleo from 5 to 7",
+			year:      1962,
+			movie:     TMDBMovie{Title: "Cléo de 5 à 7", OriginalTitle: "Cléo de 5 à 7", ReleaseDate: "1962-04-11"},
+			altTitles: []string{"Cleo from 5 to 7"},
+			want:      titleWeight + yearWeight + directorWeight/2,
+		},
+		{
+			name:      "empty director never matches",
+			title:     "Carol",
+			year:      2015,
+			director:  "—",
+			movie:     TMDBMovie{Title: "Carol", ReleaseDate: "2015-11-20"},
+			directors: []string{"Todd Haynes"},
+			want:      titleWeight + yearWeight,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scoreCandidate(tt.title, tt.year, tt.director, tt.movie, tt.directors, tt.altTitles)
+			if math.Abs(got.Confidence-tt.want) > 1e-9 {
+				t.Errorf("confidence = %.4f, want %.4f (%s)", got.Confidence, tt.want, got.Reason)
+			}
+		})
+	}
+}
+
+func TestConfidentMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		film Film
+		want bool
+	}{
+		{"unmatched", Film{Confidence: 0.9}, false},
+		{"scored before confidence existed", Film{TMDBID: 258480}, true},
+		{"below min confidence", Film{TMDBID: 258480, Confidence: 0.59}, false},
+		{"at min confidence", Film{TMDBID: 258480, Confidence: 0.6}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.film.confidentMatch(0.6); got != tt.want {
+				t.Errorf("confidentMatch = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
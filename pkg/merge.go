@@ -0,0 +1,229 @@
+package metrograph
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FilmConflict is a field that differs between two copies of the same film
+// and was left as the kept copy has it.
+type FilmConflict struct {
+	SeriesID string
+	Title    string
+	Field    string
+	Kept     string
+	Dropped  string
+}
+
+func (c FilmConflict) String() string {
+	return fmt.Sprintf("%s in series %s: %s kept %q, dropped %q", c.Title, c.SeriesID, c.Field, c.Kept, c.Dropped)
+}
+
+// MergeReport counts what merging a crawl with the previous snapshot did.
+type MergeReport struct {
+	Duplicates int // Copies of a film folded into one
+	Resolved   int // Differences settled by the rules in reconcileFilms
+	Conflicts  []FilmConflict
+}
+
+func (r *MergeReport) conflict(seriesID string, f Film, field string, kept, dropped any) {
+	r.Conflicts = append(r.Conflicts, FilmConflict{
+		SeriesID: seriesID,
+		Title:    f.Title,
+		Field:    field,
+		Kept:     fmt.Sprint(kept),
+		Dropped:  fmt.Sprint(dropped),
+	})
+}
+
+func (r *MergeReport) Print() {
+	if r.Duplicates == 0 && len(r.Conflicts) == 0 {
+		return
+	}
+	fmt.Printf("Merged %d duplicate films, resolved %d differences, %d conflicts\n", r.Duplicates, r.Resolved, len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		fmt.Printf("  Conflict: %s\n", c)
+	}
+}
+
+// mergeFilms combines a series' films from the current crawl and the previous
+// snapshot. Two films are the same if they share a TMDB match or a StableID,
+// so a film listed under two title variants is kept once. Films without any
+// StableID are only folded by their TMDB match. Current films come first and
+// win over previous ones, and earlier copies over later ones.
+func mergeFilms(seriesID string, current []Film, previous []Film, report *MergeReport) []Film {
+	var merged []Film
+	byTMDB := make(map[int]int)
+	byID := make(map[string]int)
+
+	add := func(f Film) {
+		idx, ok := -1, false
+		if tmdbID := f.matchedTMDBID(); tmdbID > 0 {
+			idx, ok = byTMDB[tmdbID]
+		}
+		if id := f.StableID(); !ok && id != "" {
+			idx, ok = byID[id]
+		}
+
+		if ok {
+			merged[idx] = reconcileFilms(seriesID, merged[idx], f, report)
+		} else {
+			merged = append(merged, f)
+			idx = len(merged) - 1
+		}
+
+		// Index both copies' keys so later duplicates of either are found
+		for _, g := range []Film{f, merged[idx]} {
+			if tmdbID := g.matchedTMDBID(); tmdbID > 0 {
+				if _, taken := byTMDB[tmdbID]; !taken {
+					byTMDB[tmdbID] = idx
+				}
+			}
+			if id := g.StableID(); id != "" {
+				if _, taken := byID[id]; !taken {
+					byID[id] = idx
+				}
+			}
+		}
+	}
+
+	for _, f := range current {
+		add(f)
+	}
+	for _, f := range previous {
+		add(f)
+	}
+	return merged
+}
+
+// reconcileFilms folds other into keep. A manual override's match always
+// wins, keep's if both have one, then any match over none, then the more
+// confident match. Details missing from keep are filled in from other;
+// differing years and directors are reported as conflicts.
+func reconcileFilms(seriesID string, keep Film, other Film, report *MergeReport) Film {
+	report.Duplicates++
+
+	keepOverride := keep.MatchStrategy == StrategyOverride
+	otherOverride := other.MatchStrategy == StrategyOverride
+	switch {
+	case keepOverride:
+		// The current crawl applied overrides.yaml as it is now
+		if describeMatch(keep) != describeMatch(other) {
+			report.Resolved++
+		}
+	case otherOverride:
+		keep.copyMatch(other)
+		report.Resolved++
+	case keep.matchedTMDBID() == 0 && other.matchedTMDBID() > 0:
+		keep.copyMatch(other)
+		report.Resolved++
+	case keep.matchedTMDBID() > 0 && other.matchedTMDBID() > 0 && keep.TMDBID != other.TMDBID:
+		switch {
+		case other.Confidence > keep.Confidence:
+			keep.copyMatch(other)
+			report.Resolved++
+		case other.Confidence < keep.Confidence:
+			report.Resolved++
+		default:
+			report.conflict(seriesID, keep, "tmdb_id", keep.TMDBID, other.TMDBID)
+		}
+	}
+
+	if keep.Year == 0 {
+		keep.Year = other.Year
+	} else if other.Year != 0 && other.Year != keep.Year {
+		report.conflict(seriesID, keep, "year", keep.Year, other.Year)
+	}
+	if keep.Director == "" {
+		keep.Director = other.Director
+	} else if other.Director != "" && normalizeTitle(other.Director) != normalizeTitle(keep.Director) {
+		report.conflict(seriesID, keep, "director", keep.Director, other.Director)
+	}
+
+	fillString(&keep.RawMetadata, other.RawMetadata)
+	fillString(&keep.MetrographURL, other.MetrographURL)
+	fillString(&keep.MetrographID, other.MetrographID)
+	fillString(&keep.Synopsis, other.Synopsis)
+	if keep.Metadata == nil {
+		keep.Metadata = other.Metadata
+	}
+	if keep.TMDBID == other.TMDBID {
+		fillString(&keep.IMDBID, other.IMDBID)
+		fillString(&keep.OriginalTitle, other.OriginalTitle)
+		fillString(&keep.OriginalLanguage, other.OriginalLanguage)
+		fillString(&keep.PosterPath, other.PosterPath)
+		if keep.Runtime == 0 {
+			keep.Runtime = other.Runtime
+		}
+		if len(keep.Genres) == 0 {
+			keep.Genres = other.Genres
+		}
+	}
+
+	keep.Screenings = mergeScreenings(keep.Screenings, other.Screenings)
+	return keep
+}
+
+// clearOverrideMatches forgets the matches overrides set on earlier snapshots'
+// films. Only the overrides in overrides.yaml now should apply.
+func clearOverrideMatches(collections map[string]Series) {
+	for _, s := range collections {
+		for i := range s.Movies {
+			if s.Movies[i].MatchStrategy == StrategyOverride {
+				s.Movies[i].copyMatch(Film{})
+			}
+		}
+	}
+}
+
+// copyMatch takes the TMDB match and the details that come with it from other.
+func (f *Film) copyMatch(other Film) {
+	f.TMDBID = other.TMDBID
+	f.IMDBID = other.IMDBID
+	f.Confidence = other.Confidence
+	f.MatchReason = other.MatchReason
+	f.MatchStrategy = other.MatchStrategy
+	f.Ignored = other.Ignored
+	f.OriginalTitle = other.OriginalTitle
+	f.OriginalLanguage = other.OriginalLanguage
+	f.Runtime = other.Runtime
+	f.Genres = other.Genres
+	f.PosterPath = other.PosterPath
+}
+
+func describeMatch(f Film) string {
+	if f.Ignored {
+		return "ignored"
+	}
+	return describeTMDBID(f.TMDBID)
+}
+
+func fillString(dst *string, src string) {
+	if *dst == "" {
+		*dst = src
+	}
+}
+
+func mergeScreenings(a []Screening, b []Screening) []Screening {
+	if len(b) == 0 {
+		return a
+	}
+
+	type screeningKey struct {
+		start     int64
+		ticketURL string
+	}
+	seen := make(map[screeningKey]bool)
+	var merged []Screening
+	for _, s := range append(append([]Screening{}, a...), b...) {
+		key := screeningKey{s.Start.Unix(), s.TicketURL}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, s)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Start.Before(merged[j].Start) })
+	return merged
+}
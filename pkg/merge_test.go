@@ -0,0 +1,98 @@
+package metrograph
+
+import (
+	"testing"
+)
+
+func TestMergeFilms(t *testing.T) {
+	type merged struct {
+		title  string
+		tmdbID int
+	}
+
+	tests := []struct {
+		name      string
+		current   []Film
+		previous  []Film
+		want      []merged
+		conflicts int
+	}{
+		{
+			name:     "title variants share a TMDB match",
+			current:  []Film{{MetrographID: "1", Title: "Carol", TMDBID: 258480, Confidence: 0.9}},
+			previous: []Film{{MetrographID: "2", Title: "Carol [4K DCP]", TMDBID: 258480, Confidence: 0.9}},
+			want:     []merged{{"Carol", 258480}},
+		},
+		{
+			name:     "same StableID keeps the more confident match",
+			current:  []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948, TMDBID: 10549, Confidence: 0.65}},
+			previous: []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948, TMDBID: 10548, Confidence: 0.95}},
+			want:     []merged{{"Hamlet", 10548}},
+		},
+		{
+			name:     "current wins over a less confident previous match",
+			current:  []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948, TMDBID: 10548, Confidence: 0.95}},
+			previous: []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948, TMDBID: 10549, Confidence: 0.65}},
+			want:     []merged{{"Hamlet", 10548}},
+		},
+		{
+			name:      "equally confident matches conflict and current stays",
+			current:   []Film{{MetrographID: "1", Title: "Hamlet", TMDBID: 10548, Confidence: 0.8}},
+			previous:  []Film{{MetrographID: "1", Title: "Hamlet", TMDBID: 10549, Confidence: 0.8}},
+			want:      []merged{{"Hamlet", 10548}},
+			conflicts: 1,
+		},
+		{
+			name:     "a match fills an unmatched current film",
+			current:  []Film{{MetrographID: "1", Title: "Daisies"}},
+			previous: []Film{{MetrographID: "1", Title: "Daisies", TMDBID: 46919, Confidence: 0.9}},
+			want:     []merged{{"Daisies", 46919}},
+		},
+		{
+			name:     "a current override beats a more confident match",
+			current:  []Film{{MetrographID: "1", Title: "Hamlet", TMDBID: 10549, MatchStrategy: StrategyOverride}},
+			previous: []Film{{MetrographID: "1", Title: "Hamlet", TMDBID: 10548, Confidence: 0.95}},
+			want:     []merged{{"Hamlet", 10549}},
+		},
+		{
+			name:     "films only in the previous snapshot come after current ones",
+			current:  []Film{{MetrographID: "1", Title: "Carol", TMDBID: 258480}},
+			previous: []Film{{MetrographID: "2", Title: "Safe", TMDBID: 18015}, {MetrographID: "1", Title: "Carol", TMDBID: 258480}},
+			want:     []merged{{"Carol", 258480}, {"Safe", 18015}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report MergeReport
+			got := mergeFilms("1", tt.current, tt.previous, &report)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d films, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				if got[i].Title != w.title || got[i].TMDBID != w.tmdbID {
+					t.Errorf("film %d = %s (tmdb %d), want %s (tmdb %d)", i, got[i].Title, got[i].TMDBID, w.title, w.tmdbID)
+				}
+			}
+			if len(report.Conflicts) != tt.conflicts {
+				t.Errorf("got conflicts %v, want %d", report.Conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergePreviousDropsOldOverrides(t *testing.T) {
+	current := map[string]Series{
+		"1": {Name: "Shakespeare", Movies: []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948}}},
+	}
+	previous := map[string]Series{
+		"1": {Name: "Shakespeare", Movies: []Film{{MetrographID: "1", Title: "Hamlet", Year: 1948, TMDBID: 10549, MatchStrategy: StrategyOverride}}},
+	}
+
+	mergePrevious(current, previous, &Overrides{})
+
+	f := current["1"].Movies[0]
+	if f.TMDBID != 0 || f.MatchStrategy != "" {
+		t.Errorf("override from the previous snapshot carried forward: tmdb %d, strategy %q", f.TMDBID, f.MatchStrategy)
+	}
+}
@@ -1,53 +1,200 @@
 package metrograph
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 	"net/url"
-	"os"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gocolly/colly"
 )
 
 type Film struct {
-	Title    string
-	rawMD    string
-	Director string
-	Year     int
-	TMDBID   int    `json:"tmdb_id,omitempty"`
-	IMDBID   string `json:"imdb_id,omitempty"`
+	ID            string  `json:"id,omitempty"` // See StableID
+	Title         string  `json:"title"`
+	RawMetadata   string  `json:"raw_metadata,omitempty"` // The ".film-metadata" line as scraped
+	Director      string  `json:"director,omitempty"`
+	Year          int     `json:"year,omitempty"`
+	TMDBID        int     `json:"tmdb_id,omitempty"`
+	IMDBID        string  `json:"imdb_id,omitempty"`
+	Confidence    float64 `json:"confidence,omitempty"`
+	MatchReason   string  `json:"match_reason,omitempty"`
+	MatchStrategy string  `json:"match_strategy,omitempty"`
+	Ignored       bool    `json:"ignored,omitempty"`
+
+	// Parsed from the series page's ".film-metadata" line, then completed
+	// from the film's own page
+	Metadata *FilmMetadata `json:"metadata,omitempty"`
+
+	// Scraped from the film's Metrograph page
+	MetrographURL string      `json:"metrograph_url,omitempty"`
+	MetrographID  string      `json:"metrograph_id,omitempty"`
+	Synopsis      string      `json:"synopsis,omitempty"`
+	Screenings    []Screening `json:"screenings,omitempty"`
+
+	// Details copied from TMDB once the film is matched
+	OriginalTitle    string   `json:"original_title,omitempty"`
+	OriginalLanguage string   `json:"original_language,omitempty"`
+	Runtime          int      `json:"runtime,omitempty"`
+	Genres           []string `json:"genres,omitempty"`
+	PosterPath       string   `json:"poster_path,omitempty"`
+}
+
+func (f *Film) applyDetails(movie TMDBMovie) {
+	f.IMDBID = movie.IMDBId
+	f.OriginalTitle = movie.OriginalTitle
+	f.OriginalLanguage = movie.OriginalLanguage
+	f.Runtime = movie.Runtime
+	f.PosterPath = movie.PosterPath
+
+	f.Genres = nil
+	for _, g := range movie.Genres {
+		f.Genres = append(f.Genres, g.Name)
+	}
 }
 
 type Series struct {
-	Name   string
-	URL    string
-	ID     string
-	Movies []Film
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	ID     string `json:"id"`
+	Movies []Film `json:"movies"`
+
+	// Where the series page ended up after client-side redirects
+	CanonicalURL string `json:"canonical_url,omitempty"`
+
+	Description string `json:"description,omitempty"`
+	StartDate   string `json:"start_date,omitempty"` // YYYY-MM-DD
+	EndDate     string `json:"end_date,omitempty"`   // YYYY-MM-DD
+	ImageURL    string `json:"image_url,omitempty"`
+	Curator     string `json:"curator,omitempty"`
 }
 
 type ScrapedData struct {
-	Date        string            `json:"date"`
-	Collections map[string]Series `json:"collections"`
+	SchemaVersion int               `json:"schema_version"` // See SnapshotSchemaVersion
+	Date          string            `json:"date"`
+	Collections   map[string]Series `json:"collections"`
+
+	runID int64 // Set when loaded from a Store
+}
+
+// LoadScrapedData reads a snapshot written by the crawler, upgrading it to
+// the current schema version if it is older.
+func LoadScrapedData(jsonFile string) (ScrapedData, error) {
+	var scrapedData ScrapedData
+
+	data, err := readSnapshotFile(jsonFile)
+	if err != nil {
+		return scrapedData, fmt.Errorf("failed to read JSON file %s: %w", jsonFile, err)
+	}
+	data, _, err = migrateSnapshot(data)
+	if err != nil {
+		return scrapedData, fmt.Errorf("failed to migrate JSON file %s: %w", jsonFile, err)
+	}
+	if err := json.Unmarshal(data, &scrapedData); err != nil {
+		return scrapedData, fmt.Errorf("failed to parse JSON file %s: %w", jsonFile, err)
+	}
+	return scrapedData, nil
 }
 
 const BASE string = "https://metrograph.com"
-const TMDB_BASE_URL string = "https://api.themoviedb.org/3"
 
-type TMDBSearchResponse struct {
-	Results []TMDBMovie `json:"results"`
+type CrawlerConfig struct {
+	SkipFilmPages bool // Only scrape series pages, not each film's own page
+
+	// On-disk cache of Metrograph pages; disabled when CacheDir is empty
+	CacheDir    string
+	CacheMaxAge time.Duration // Pages younger than this are not revalidated
+	Offline     bool          // Crawl only from the cache, never the network
+
+	// Politeness; zero values fall back to the defaults below
+	UserAgent        string
+	Parallelism      int           // Concurrent requests per domain
+	Delay            time.Duration // Between requests to the same domain
+	RandomDelay      time.Duration // Extra random delay up to this
+	RespectRobotsTxt bool
+	DomainLimits     []DomainLimit // Checked before the default limit
+
+	Selectors Selectors        // Empty fields use DefaultSelectors
+	Health    HealthThresholds // Checked before matching, so a broken crawl fails fast
+}
+
+// DomainLimit overrides the crawl limits for domains matching a glob such as
+// "*.metrograph.com".
+type DomainLimit struct {
+	DomainGlob  string
+	Parallelism int
+	Delay       time.Duration
+	RandomDelay time.Duration
+}
+
+const (
+	defaultCrawlUserAgent   = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+	defaultCrawlParallelism = 2
+	defaultCrawlDelay       = 250 * time.Millisecond
+)
+
+// newCollector returns an async collector with the configured limits. Clones
+// share its limits, so they hold across every series and film page.
+func newCollector(config CrawlerConfig) (*colly.Collector, error) {
+	if config.UserAgent == "" {
+		config.UserAgent = defaultCrawlUserAgent
+	}
+	if config.Parallelism <= 0 {
+		config.Parallelism = defaultCrawlParallelism
+	}
+	if config.Delay <= 0 {
+		config.Delay = defaultCrawlDelay
+	}
+
+	c := colly.NewCollector(colly.Async(true))
+	c.UserAgent = config.UserAgent
+	// robots.txt cannot be fetched when crawling offline
+	c.IgnoreRobotsTxt = !config.RespectRobotsTxt || config.Offline
+
+	for _, dl := range config.DomainLimits {
+		err := c.Limit(&colly.LimitRule{
+			DomainGlob:  dl.DomainGlob,
+			Parallelism: dl.Parallelism,
+			Delay:       dl.Delay,
+			RandomDelay: dl.RandomDelay,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to set crawl limit for %s: %w", dl.DomainGlob, err)
+		}
+	}
+
+	err := c.Limit(&colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: config.Parallelism,
+		Delay:       config.Delay,
+		RandomDelay: config.RandomDelay,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set crawl limit: %w", err)
+	}
+
+	return c, nil
+}
+
+// crawlResults guards the series being built by concurrent collector
+// callbacks.
+type crawlResults struct {
+	mu       sync.Mutex
+	series   map[string]Series
+	untitled map[string]int // Films dropped for an empty title, by series ID
 }
 
-type TMDBMovie struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	ReleaseDate string `json:"release_date"`
-	IMDBId      string `json:"imdb_id,omitempty"`
+func (r *crawlResults) update(id string, fn func(s *Series)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.series[id]
+	fn(&s)
+	r.series[id] = s
 }
 
 func extractSeriesID(urlStr string) (string, error) {
@@ -83,6 +230,14 @@ func cleanTitle(title string) []string {
 		variations = append(variations, withoutPresents)
 	}
 
+	// Remove parentheses and contents
+	// Carol (Restored) -> Carol
+	parenRe := regexp.MustCompile(`\([^)]*\)`)
+	withoutParens := strings.TrimSpace(parenRe.ReplaceAllString(title, ""))
+	if withoutParens != title && withoutParens != "" {
+		variations = append(variations, withoutParens)
+	}
+
 	// Combine both rules
 	withoutBoth := strings.TrimSpace(presentsRe.ReplaceAllString(withoutBrackets, ""))
 	if withoutBoth != title && withoutBoth != withoutBrackets && withoutBoth != withoutPresents && withoutBoth != "" {
@@ -92,83 +247,32 @@ func cleanTitle(title string) []string {
 	return variations
 }
 
-func searchTMDBWithTitle(title string, year int, apiKey string) (*TMDBMovie, error) {
-	// URL encode the title
-	encodedTitle := url.QueryEscape(title)
-	searchURL := fmt.Sprintf("%s/search/movie?api_key=%s&query=%s", TMDB_BASE_URL, apiKey, encodedTitle)
-
-	// TODO: remove year and search again if no results
-	if year > 0 {
-		searchURL += fmt.Sprintf("&year=%d", year)
-	}
-
-	// Rate limiting - wait between requests
-	// TODO: Handle rate limit better
-	time.Sleep(250 * time.Millisecond)
+func Crawl(ctx context.Context, crawlerConfig CrawlerConfig, tmdbConfig TMDBConfig, overrides *Overrides) (map[string]Series, error) {
 
-	resp, err := http.Get(searchURL)
+	c, err := newCollector(crawlerConfig)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("TMDB API returned status %d", resp.StatusCode)
-	}
-
-	var searchResp TMDBSearchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
-		return nil, err
-	}
-
-	// Return the first result if available
-	if len(searchResp.Results) > 0 {
-		return &searchResp.Results[0], nil
-	}
-
-	return nil, nil // No results, but no error
-}
-
-func SearchTMDB(title string, year int, apiKey string) (*TMDBMovie, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("TMDB API key is required")
-	}
 
-	// Get all title variations
-	titleVariations := cleanTitle(title)
-
-	// Try each variation
-	for i, variation := range titleVariations {
-		if i > 0 {
-			fmt.Printf("  Trying variation: %s\n", variation)
-		}
-
-		movie, err := searchTMDBWithTitle(variation, year, apiKey)
+	var httpCache *HTTPCache
+	if crawlerConfig.CacheDir != "" {
+		httpCache, err = NewHTTPCache(crawlerConfig.CacheDir, crawlerConfig.CacheMaxAge, crawlerConfig.Offline)
 		if err != nil {
 			return nil, err
 		}
-		if movie != nil {
-			if i > 0 {
-				fmt.Printf("  Success with variation: %s\n", variation)
-			}
-			return movie, nil
-		}
+		// Clones share the parent's transport, so series and film pages are cached too
+		c.WithTransport(httpCache)
+	} else if crawlerConfig.Offline {
+		return nil, fmt.Errorf("offline crawling needs crawler.cache.dir to be set")
 	}
 
-	return nil, fmt.Errorf("no results found for %s (%d) or any variations", title, year)
-}
-
-func Crawl(tmdbAPIKey string) (map[string]Series, error) {
-
-	c := colly.NewCollector()
-	c.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
-
+	sel := crawlerConfig.Selectors.withDefaults()
 	series := []Series{}
-	results := map[string]Series{}
+	results := &crawlResults{series: map[string]Series{}, untitled: map[string]int{}}
 
 	// Get Metograph series website
-	c.OnHTML(".row", func(h *colly.HTMLElement) {
-		h.ForEach(".movie_title", func(i int, h *colly.HTMLElement) {
+	c.OnHTML(sel.SeriesRow, func(h *colly.HTMLElement) {
+		h.ForEach(sel.SeriesLink, func(i int, h *colly.HTMLElement) {
 			seriesURL := h.ChildAttr("a", "href")
 			seriesName := h.Text
 			fmt.Printf("Found series: %s -> %s\n", seriesName, seriesURL)
@@ -185,21 +289,33 @@ func Crawl(tmdbAPIKey string) (map[string]Series, error) {
 		fmt.Println("Visiting", r.URL.String())
 	})
 
-	err := c.Visit(BASE + "/series/")
+	err = c.Visit(BASE + "/series/")
 	if err != nil {
 		return nil, err
 	}
+	c.Wait()
 
+	// Validate every series URL and seed the results before any visit starts,
+	// as callbacks of running collectors write to the same map
+	results.mu.Lock()
 	for i, s := range series {
 		id, err := extractSeriesID(s.URL)
 		if err != nil {
+			results.mu.Unlock()
 			return nil, err
 		}
 		series[i].ID = id
-		results[id] = series[i]
+		results.series[id] = series[i]
+	}
+	results.mu.Unlock()
+
+	var movieCollectors []*colly.Collector
+	for _, s := range series {
+		id := s.ID
 
 		// Create a new collector for each series to avoid variable capture issues
 		movieCollector := c.Clone()
+		movieCollectors = append(movieCollectors, movieCollector)
 		// DEBUG
 		/*
 			movieCollector.OnRequest(func(r *colly.Request) {
@@ -207,166 +323,145 @@ func Crawl(tmdbAPIKey string) (map[string]Series, error) {
 			})
 		*/
 
-		movieCollector.OnResponse(func(r *colly.Response) {
-
-			// Look for JavaScript redirects
-			body := string(r.Body)
-			re := regexp.MustCompile(`window\.location\.replace\(['"]([^'"]+)['"]`)
-			matches := re.FindStringSubmatch(body)
-			if len(matches) > 1 {
-				redirectURL := matches[1]
-				fmt.Printf("Found JavaScript redirect to: %s\n", redirectURL)
-
-				movieCollector.Visit(BASE + redirectURL)
-			}
+		followClientRedirects(movieCollector, func(finalURL string) {
+			results.update(id, func(s *Series) {
+				s.CanonicalURL = finalURL
+			})
 		})
 
-		movieCollector.OnHTML(".item", func(h *colly.HTMLElement) {
-			title := strings.TrimSpace(h.ChildText(".title"))
-			metadata := h.ChildText(".film-metadata")
+		collectSeriesMetadata(movieCollector, sel, results, id)
 
-			if title != "" {
-				m := Film{
-					Title: title,
-					rawMD: metadata,
-				}
+		movieCollector.OnHTML(sel.Film, func(h *colly.HTMLElement) {
+			title := strings.TrimSpace(h.ChildText(sel.FilmTitle))
+			metadata := h.ChildText(sel.FilmMetadata)
+			filmURL := absoluteURL(h.ChildAttr(sel.FilmLink, "href"))
 
-				tmp := results[id]
-				tmp.Movies = append(tmp.Movies, m)
-				results[id] = tmp
+			if title == "" {
+				results.mu.Lock()
+				results.untitled[id]++
+				results.mu.Unlock()
+				return
 			}
+
+			m := Film{
+				Title:         title,
+				RawMetadata:   metadata,
+				MetrographURL: filmURL,
+				MetrographID:  extractFilmID(filmURL),
+			}
+
+			results.update(id, func(s *Series) {
+				s.Movies = append(s.Movies, m)
+			})
 		})
 
 		movieCollector.Visit(BASE + s.URL)
 	}
 
+	for _, mc := range movieCollectors {
+		mc.Wait()
+	}
+
 	// Parse metadata for movies that have it
-	for seriesID, s := range results {
-		var movieList []Film
-		for _, m := range s.Movies {
-			if m.rawMD != "" {
-				parts := strings.Split(m.rawMD, "/")
-				if len(parts) >= 2 {
-					firstPart := strings.TrimSpace(parts[0])
-					secondPart := strings.TrimSpace(parts[1])
-
-					// Check if first part is a year (4 digits)
-					// TODO better handling of movies that is titled as a year
-					if yr, err := strconv.Atoi(firstPart); err == nil && yr > 1800 && yr < 2100 {
-						// First part is year, so director is empty
-						m.Year = yr
-					} else {
-						// First part is director, second part should be year
-						m.Director = firstPart
-						if yr, err := strconv.Atoi(secondPart); err == nil {
-							m.Year = yr
-						}
-					}
-				}
+	for _, s := range results.series {
+		for i, m := range s.Movies {
+			if m.RawMetadata == "" {
+				continue
 			}
-			movieList = append(movieList, m)
+
+			md := ParseFilmMetadata(m.Title, m.RawMetadata)
+			s.Movies[i].Metadata = &md
+			s.Movies[i].Director = strings.Join(md.Directors, ", ")
+			s.Movies[i].Year = md.Year
 		}
+	}
 
-		s.Movies = movieList
-		results[seriesID] = s
+	// Follow each film to its own page for showtimes and synopsis
+	if !crawlerConfig.SkipFilmPages {
+		scrapeFilmPages(c, sel, results.series)
 	}
 
-	return results, err
-}
+	if httpCache != nil {
+		httpCache.PrintStats()
+	}
 
-func populateIMDBID(films []Film, tmdbAPIKey string) {
-	// Search TMDB for movie
-	for i := range films {
-		if tmdbAPIKey != "" {
-			if tmdbMovie, err := SearchTMDB(films[i].Title, films[i].Year, tmdbAPIKey); err == nil {
-				films[i].TMDBID = tmdbMovie.ID
-				fmt.Printf("Found TMDB ID for %s: %d\n", films[i].Title, films[i].TMDBID)
-			} else {
-				fmt.Printf("TMDB lookup failed for %s: %v\n", films[i].Title, err)
-			}
-		}
+	if err := CheckCrawlHealth(results.series, results.untitled, crawlerConfig.Health); err != nil {
+		return nil, err
 	}
+
+	// Pin or ignore films with manual overrides, then resolve the rest to TMDB IDs
+	ApplyOverrides(results.series, overrides)
+	resolver := NewResolver(tmdbConfig)
+	PrintMatchStats(resolver.Enrich(ctx, results.series))
+	resolver.PrintCacheStats()
+	if err := resolver.Close(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	assignFilmIDs(results.series)
+
+	return results.series, nil
 }
 
-func UpdateFileStore(scrappedData map[string]Series, curFilePath string) error {
-	data, err := os.ReadFile(curFilePath)
+// UpdateFileStore merges a crawl with the latest snapshot in the snapshot dir,
+// if there is one, and writes the result as today's snapshot. overrides are
+// re-applied to the merged films.
+func UpdateFileStore(scrappedData map[string]Series, config SnapshotConfig, policy EligibilityPolicy, overrides *Overrides) error {
+	previous, err := config.FindSnapshot(0)
 	if err != nil {
-		return fmt.Errorf("failed to read JSON file %s: %w", curFilePath, err)
+		return err
 	}
 
-	var fileData ScrapedData
-	if err := json.Unmarshal(data, &fileData); err != nil {
-		return fmt.Errorf("failed to parse JSON file %s: %w", curFilePath, err)
+	if previous != "" {
+		fileData, err := LoadScrapedData(previous)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Merging with previous snapshot %s\n", previous)
+		mergePrevious(scrappedData, fileData.Collections, overrides)
 	}
+	return writeToFile(scrappedData, config, policy)
+}
 
+// mergePrevious adds films from the previous snapshot to the series in
+// scrappedData that are still listed, folding duplicate films into one and
+// reporting conflicts between their copies. Override matches in previous are
+// dropped and overrides re-applied afterwards, so a removed override does not
+// live on in later snapshots.
+func mergePrevious(scrappedData map[string]Series, previous map[string]Series, overrides *Overrides) {
+	assignFilmIDs(previous)
+	assignFilmIDs(scrappedData)
+	clearOverrideMatches(previous)
+
+	var report MergeReport
 	for id, s := range scrappedData {
-		if col, ok := fileData.Collections[id]; ok {
-			merged := dedupeFilms(col.Movies, s.Movies)
-			if len(merged) != len(s.Movies) {
-				fmt.Println(fmt.Sprintf("Updated series %s from %d, to %d movie", s.Name, len(s.Movies), len(merged)))
-			}
-			s.Movies = merged
-			scrappedData[id] = s
+		merged := mergeFilms(id, s.Movies, previous[id].Movies, &report)
+		if len(merged) != len(s.Movies) {
+			fmt.Println(fmt.Sprintf("Updated series %s from %d, to %d movie", s.Name, len(s.Movies), len(merged)))
 		}
+		s.Movies = merged
+		scrappedData[id] = s
 	}
+	report.Print()
 
-	return writeToFile(scrappedData)
+	ApplyOverrides(scrappedData, overrides)
 }
 
-func writeToFile(scrappedSeries map[string]Series) error {
-	// Filter results to only include series with >2 valid movies for JSON output
-	filteredResults := make(map[string]Series)
-	for seriesID, series := range scrappedSeries {
-		validMovies := 0
-		for _, movie := range series.Movies {
-			if movie.TMDBID > 0 {
-				validMovies++
-			}
-		}
-		if validMovies > 2 {
-			filteredResults[seriesID] = series
-		}
-	}
-
-	// Generate filename with today's date
-	today := time.Now().Format("2006-01-02")
-	filename := fmt.Sprintf("%s.json", today)
+func writeToFile(scrappedSeries map[string]Series, config SnapshotConfig, policy EligibilityPolicy) error {
+	filteredResults := policy.EligibleSeries(scrappedSeries)
 
 	// Create ScrapedData structure with date and collections
 	scrapedData := ScrapedData{
-		Date:        today,
+		Date:        time.Now().Format(snapshotDateFormat),
 		Collections: filteredResults,
 	}
 
-	// Pretty print the JSON data
-	jsonData, err := json.MarshalIndent(scrapedData, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Write to file
-	err = os.WriteFile(filename, jsonData, 0644)
+	filename, err := config.writeSnapshot(scrapedData)
 	if err != nil {
-		log.Fatalf("Failed to write to %s: %v", filename, err)
+		return err
 	}
 
 	fmt.Printf("Results written to %s\n", filename)
-	fmt.Printf("Found %d total series, %d series with >2 valid movies\n", len(scrappedSeries), len(filteredResults))
+	fmt.Printf("Found %d total series, %d eligible series\n", len(scrappedSeries), len(filteredResults))
 	return nil
 }
-
-func dedupeFilms(colA []Film, colB []Film) []Film {
-	var results []Film
-	added := make(map[string]struct{})
-	for _, f := range colA {
-		results = append(results, f)
-		added[f.Title] = struct{}{}
-	}
-
-	for _, f := range colB {
-		if _, ok := added[f.Title]; !ok {
-			results = append(results, f)
-		}
-	}
-	return results
-}
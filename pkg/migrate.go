@@ -0,0 +1,128 @@
+package metrograph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// SnapshotSchemaVersion is the snapshot format this build writes. Bump it and
+// add a migration below whenever a json name or meaning changes.
+const SnapshotSchemaVersion = 2
+
+// snapshotMigrations[i] upgrades a decoded snapshot from version i+1 to i+2.
+var snapshotMigrations = []func(doc map[string]any) error{
+	migrateSnapshotV1,
+}
+
+// migrateSnapshotV1 renames the Film and Series fields that had no json tags
+// and were written under their Go names. Snapshots without schema_version are
+// version 1.
+func migrateSnapshotV1(doc map[string]any) error {
+	collections, ok := doc["collections"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	for id, raw := range collections {
+		series, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("series %s is not an object", id)
+		}
+		renameKeys(series, map[string]string{"Name": "name", "URL": "url", "ID": "id", "Movies": "movies"})
+
+		movies, _ := series["movies"].([]any)
+		for i, rawFilm := range movies {
+			film, ok := rawFilm.(map[string]any)
+			if !ok {
+				return fmt.Errorf("film %d of series %s is not an object", i+1, id)
+			}
+			renameKeys(film, map[string]string{"Title": "title", "Director": "director", "Year": "year"})
+		}
+	}
+	return nil
+}
+
+// renameKeys moves obj[old] to obj[new] unless new is already set.
+func renameKeys(obj map[string]any, names map[string]string) {
+	for oldName, newName := range names {
+		v, ok := obj[oldName]
+		if !ok {
+			continue
+		}
+		delete(obj, oldName)
+		if _, exists := obj[newName]; !exists {
+			obj[newName] = v
+		}
+	}
+}
+
+// decodeSnapshotDocument decodes a snapshot without a Go type, keeping
+// numbers as json.Number so IDs survive a round trip.
+func decodeSnapshotDocument(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("snapshot is not a JSON object")
+	}
+	return doc, nil
+}
+
+// snapshotVersion returns the schema_version of a decoded snapshot.
+func snapshotVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema_version is not a number")
+	}
+	v, err := n.Int64()
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid schema_version %s", n)
+	}
+	return int(v), nil
+}
+
+// upgradeSnapshotDocument runs every migration from the document's version up
+// to SnapshotSchemaVersion and returns the version it started at.
+func upgradeSnapshotDocument(doc map[string]any) (int, error) {
+	from, err := snapshotVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if from > SnapshotSchemaVersion {
+		return from, fmt.Errorf("schema version %d is newer than this build supports (%d)", from, SnapshotSchemaVersion)
+	}
+
+	for v := from; v < SnapshotSchemaVersion; v++ {
+		if err := snapshotMigrations[v-1](doc); err != nil {
+			return from, fmt.Errorf("failed to migrate from schema version %d: %w", v, err)
+		}
+	}
+	doc["schema_version"] = json.Number(strconv.Itoa(SnapshotSchemaVersion))
+	return from, nil
+}
+
+// migrateSnapshot upgrades raw snapshot JSON to the current schema version.
+// It returns data unchanged when it is already current.
+func migrateSnapshot(data []byte) ([]byte, int, error) {
+	doc, err := decodeSnapshotDocument(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	from, err := upgradeSnapshotDocument(doc)
+	if err != nil || from == SnapshotSchemaVersion {
+		return data, from, err
+	}
+
+	data, err = json.Marshal(doc)
+	return data, from, err
+}
@@ -0,0 +1,95 @@
+package metrograph
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSnapshotV1(t *testing.T) {
+	result, err := ValidateSnapshot("testdata/snapshot_v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != 1 {
+		t.Errorf("version = %d, want 1", result.Version)
+	}
+	if len(result.Problems) > 0 {
+		t.Errorf("unexpected problems: %v", result.Problems)
+	}
+}
+
+func TestLoadScrapedDataV1(t *testing.T) {
+	data, err := LoadScrapedData("testdata/snapshot_v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, ok := data.Collections["HO00000123"]
+	if !ok {
+		t.Fatalf("series missing after migration: %+v", data.Collections)
+	}
+	if s.Name != "Todd Haynes" || s.ID != "HO00000123" || s.URL != "/series/?vista_series_id=HO00000123" {
+		t.Errorf("series fields not migrated: %+v", s)
+	}
+	if len(s.Movies) != 3 {
+		t.Fatalf("got %d films, want 3", len(s.Movies))
+	}
+	carol := s.Movies[0]
+	if carol.Title != "Carol" || carol.Director != "Todd Haynes" || carol.Year != 2015 || carol.TMDBID != 258480 || carol.IMDBID != "tt2402927" {
+		t.Errorf("film fields not migrated: %+v", carol)
+	}
+}
+
+func TestValidateSnapshotProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		problem string
+	}{
+		{
+			name:    "unknown film property",
+			json:    `{"schema_version": 2, "date": "2025-03-01", "collections": {"1": {"name": "X", "url": "/x", "id": "1", "movies": [{"title": "Carol", "colour": "red"}]}}}`,
+			problem: `unknown property "colour"`,
+		},
+		{
+			name:    "wrong type",
+			json:    `{"schema_version": 2, "date": "2025-03-01", "collections": {"1": {"name": "X", "url": "/x", "id": "1", "movies": [{"title": "Carol", "year": "2015"}]}}}`,
+			problem: "/collections/1/movies/0/year: expected integer, got string",
+		},
+		{
+			name:    "missing required property",
+			json:    `{"schema_version": 2, "collections": {}}`,
+			problem: `missing required property "date"`,
+		},
+		{
+			name:    "newer schema version",
+			json:    `{"schema_version": 99, "date": "2025-03-01", "collections": {}}`,
+			problem: "newer than this build supports",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ValidateSnapshot(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, p := range result.Problems {
+				if strings.Contains(p, tt.problem) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("problems %v do not mention %q", result.Problems, tt.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package metrograph
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const StrategyOverride = "override"
+
+// Override pins a Metrograph title to a TMDB ID, or ignores it entirely.
+// Year and SeriesID are optional and narrow the override when set.
+type Override struct {
+	Title    string `yaml:"title"`
+	Year     int    `yaml:"year,omitempty"`
+	SeriesID string `yaml:"series_id,omitempty"`
+	TMDBID   int    `yaml:"tmdb_id,omitempty"`
+	Ignore   bool   `yaml:"ignore,omitempty"`
+}
+
+type Overrides struct {
+	Overrides []Override `yaml:"overrides"`
+}
+
+// LoadOverrides reads an overrides file. A missing file is not an error and
+// yields an empty set.
+func LoadOverrides(path string) (*Overrides, error) {
+	o := &Overrides{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overrides file %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, o); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides file %s: %w", path, err)
+	}
+
+	return o, nil
+}
+
+func (o *Overrides) Save(path string) error {
+	data, err := yaml.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("failed to encode overrides: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write overrides file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (ov Override) sameKey(other Override) bool {
+	return strings.EqualFold(strings.TrimSpace(ov.Title), strings.TrimSpace(other.Title)) &&
+		ov.Year == other.Year && ov.SeriesID == other.SeriesID
+}
+
+func (ov Override) String() string {
+	s := ov.Title
+	if ov.Year > 0 {
+		s += fmt.Sprintf(" (%d)", ov.Year)
+	}
+	if ov.SeriesID != "" {
+		s += fmt.Sprintf(" [series %s]", ov.SeriesID)
+	}
+	if ov.Ignore {
+		return s + " -> ignore"
+	}
+	return s + fmt.Sprintf(" -> TMDB %d", ov.TMDBID)
+}
+
+// Add stores an override, replacing any existing one with the same title,
+// year and series.
+func (o *Overrides) Add(ov Override) {
+	for i := range o.Overrides {
+		if o.Overrides[i].sameKey(ov) {
+			o.Overrides[i] = ov
+			return
+		}
+	}
+	o.Overrides = append(o.Overrides, ov)
+}
+
+// Remove deletes the override with the same title, year and series and
+// reports whether one was found.
+func (o *Overrides) Remove(ov Override) bool {
+	for i := range o.Overrides {
+		if o.Overrides[i].sameKey(ov) {
+			o.Overrides = append(o.Overrides[:i], o.Overrides[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the most specific override for a film in a series, or nil.
+func (o *Overrides) Lookup(seriesID string, f Film) *Override {
+	if o == nil {
+		return nil
+	}
+
+	var best *Override
+	bestScore := -1
+	for i, ov := range o.Overrides {
+		if !strings.EqualFold(strings.TrimSpace(ov.Title), strings.TrimSpace(f.Title)) {
+			continue
+		}
+		if ov.Year > 0 && ov.Year != f.Year {
+			continue
+		}
+		if ov.SeriesID != "" && ov.SeriesID != seriesID {
+			continue
+		}
+
+		score := 0
+		if ov.Year > 0 {
+			score++
+		}
+		if ov.SeriesID != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = &o.Overrides[i], score
+		}
+	}
+	return best
+}
+
+// ApplyOverrides pins or ignores films in place according to the overrides.
+func ApplyOverrides(collections map[string]Series, o *Overrides) {
+	if o == nil || len(o.Overrides) == 0 {
+		return
+	}
+
+	for seriesID, s := range collections {
+		for i := range s.Movies {
+			film := &s.Movies[i]
+			ov := o.Lookup(seriesID, *film)
+			if ov == nil {
+				continue
+			}
+
+			if ov.Ignore {
+				film.Ignored = true
+				film.TMDBID = 0
+				film.Confidence = 0
+				film.MatchReason = "ignored by override"
+				film.MatchStrategy = StrategyOverride
+				continue
+			}
+
+			film.Ignored = false
+			film.TMDBID = ov.TMDBID
+			film.Confidence = 1
+			film.MatchReason = "manual override"
+			film.MatchStrategy = StrategyOverride
+		}
+	}
+}
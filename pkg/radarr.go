@@ -2,10 +2,8 @@ package metrograph
 
 import (
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"golift.io/starr"
@@ -217,41 +215,38 @@ func (r *RadarrClient) DeleteTag(tagName string) error {
 	return nil
 }
 
-func ProcessJSONToRadarr(jsonFile string, config RadarrConfig) error {
-	data, err := os.ReadFile(jsonFile)
-	if err != nil {
-		return fmt.Errorf("failed to read JSON file %s: %w", jsonFile, err)
-	}
-
-	var scrapedData ScrapedData
-	if err := json.Unmarshal(data, &scrapedData); err != nil {
-		return fmt.Errorf("failed to parse JSON file %s: %w", jsonFile, err)
-	}
+// ProcessToRadarr adds the films the policy trusts from every eligible series
+// to Radarr, tagged by series, after the rules have filtered them. source
+// names the snapshot in output, and changes are recorded in store when it is
+// not nil.
+func ProcessToRadarr(scrapedData ScrapedData, source string, config RadarrConfig, policy EligibilityPolicy, rules *RuleSet, overrides *Overrides, store *Store) error {
+	ApplyOverrides(scrapedData.Collections, overrides)
+	scrapedData, report := rules.Apply(scrapedData)
+	report.PrintSummary()
 
 	radarrClient, err := NewRadarrClient(config)
 	if err != nil {
 		return fmt.Errorf("failed to create Radarr client: %w", err)
 	}
 
-	fmt.Printf("Processing %d series from %s (scraped on %s)\n", len(scrapedData.Collections), jsonFile, scrapedData.Date)
+	fmt.Printf("Processing %d series from %s (scraped on %s)\n", len(scrapedData.Collections), source, scrapedData.Date)
 	results := scrapedData.Collections
 
 	for seriesID, series := range results {
-		// Count valid movies (those with TMDB IDs)
-		validMovies := 0
-		for _, movie := range series.Movies {
-			if movie.TMDBID > 0 {
-				validMovies++
-			}
+		decision := policy.Evaluate(seriesID, series)
+		if decision.LowConfidence > 0 {
+			fmt.Printf("Holding back %d low-confidence match(es) in series '%s'\n", decision.LowConfidence, series.Name)
 		}
-
-		if validMovies < 2 {
+		if !decision.Eligible {
 			continue
 		}
 
 		// Create tag for the series
 		tagName := fmt.Sprintf("metrograph-%s", seriesID)
 		tagID, err := radarrClient.CreateTag(tagName)
+		store.RecordSyncAction(scrapedData, SyncAction{
+			Target: SyncTargetRadarr, Action: SyncActionCreateTag, SeriesID: seriesID, Detail: tagName, Err: err,
+		})
 		if err != nil {
 			fmt.Printf("Warning: Failed to create tag for series %s: %v\n", series.Name, err)
 			continue
@@ -259,17 +254,19 @@ func ProcessJSONToRadarr(jsonFile string, config RadarrConfig) error {
 
 		// Add each movie with the tag
 		addedCount := 0
-		for _, movie := range series.Movies {
-			if movie.TMDBID > 0 {
-				err := radarrClient.AddMovie(movie.TMDBID, movie.Title, movie.Year, []int{tagID})
-				if err != nil {
-					fmt.Printf("Warning: Failed to add movie %s: %v\n", movie.Title, err)
-				} else {
-					addedCount++
-				}
+		movies := policy.MatchedFilms(series)
+		for _, movie := range movies {
+			err := radarrClient.AddMovie(movie.TMDBID, movie.Title, movie.Year, []int{tagID})
+			store.RecordSyncAction(scrapedData, SyncAction{
+				Target: SyncTargetRadarr, Action: SyncActionAddMovie, SeriesID: seriesID, TMDBID: movie.TMDBID, Detail: movie.Title, Err: err,
+			})
+			if err != nil {
+				fmt.Printf("Warning: Failed to add movie %s: %v\n", movie.Title, err)
+			} else {
+				addedCount++
 			}
 		}
-		fmt.Printf("Added %d/%d movies from series '%s'\n", addedCount, validMovies, series.Name)
+		fmt.Printf("Added %d/%d movies from series '%s'\n", addedCount, len(movies), series.Name)
 	}
 
 	return nil
@@ -0,0 +1,119 @@
+package metrograph
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gocolly/colly"
+)
+
+const (
+	maxClientRedirects = 5
+	redirectChainKey   = "redirect_chain"
+)
+
+// JavaScript redirects found in the <script> elements of Metrograph pages,
+// tried in order. Assignments need a window., document., self. or top.
+// prefix so variables and attributes named location are not mistaken for one.
+var clientRedirectPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:\b(?:window|document|self|top)\.)?\blocation\.(?:replace|assign)\(\s*['"]([^'"]+)['"]\s*\)`),
+	regexp.MustCompile(`\b(?:window|document|self|top)\.location(?:\.href)?\s*=\s*['"]([^'"]+)['"]`),
+}
+
+var (
+	metaRefreshRe    = regexp.MustCompile(`(?is)<meta[^>]*http-equiv\s*=\s*["']?refresh["']?[^>]*>`)
+	metaRefreshURLRe = regexp.MustCompile(`(?i)url\s*=\s*['"]?([^'">\s;]+)`)
+	scriptRe         = regexp.MustCompile(`(?is)<script\b[^>]*>(.*?)</script>`)
+)
+
+// findClientRedirect returns the target of a meta refresh or JavaScript
+// redirect in body, and which kind it was.
+func findClientRedirect(body []byte) (string, string, bool) {
+	if tag := metaRefreshRe.Find(body); tag != nil {
+		if m := metaRefreshURLRe.FindStringSubmatch(html.UnescapeString(string(tag))); m != nil {
+			return m[1], "meta refresh", true
+		}
+	}
+
+	for _, re := range clientRedirectPatterns {
+		for _, script := range scriptRe.FindAllSubmatch(body, -1) {
+			if m := re.FindSubmatch(script[1]); m != nil {
+				return html.UnescapeString(string(m[1])), "JavaScript", true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// resolveRedirectURL resolves an absolute, root-relative or relative target
+// against the page it was found on.
+func resolveRedirectURL(from *url.URL, target string) (string, error) {
+	ref, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return "", err
+	}
+	resolved := from.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", fmt.Errorf("unsupported redirect scheme %q", resolved.Scheme)
+	}
+	resolved.Fragment = ""
+	return resolved.String(), nil
+}
+
+// followClientRedirects makes c follow meta refresh and JavaScript redirects,
+// giving up on loops and after maxClientRedirects hops. onFinal is called
+// with the URL of every page that does not redirect further, and with
+// redirect targets already visited in this crawl.
+func followClientRedirects(c *colly.Collector, onFinal func(finalURL string)) {
+	c.OnResponse(func(r *colly.Response) {
+		target, kind, ok := findClientRedirect(r.Body)
+		if !ok {
+			if onFinal != nil {
+				onFinal(r.Request.URL.String())
+			}
+			return
+		}
+
+		from := r.Request.URL.String()
+		next, err := resolveRedirectURL(r.Request.URL, target)
+		if err != nil {
+			fmt.Printf("Ignoring %s redirect on %s to %q: %v\n", kind, from, target, err)
+			return
+		}
+
+		chain, _ := r.Ctx.GetAny(redirectChainKey).([]string)
+		if len(chain) == 0 {
+			chain = []string{from}
+		}
+		for _, seen := range chain {
+			if seen == next {
+				fmt.Printf("Redirect loop: %s -> %s\n", strings.Join(chain, " -> "), next)
+				return
+			}
+		}
+		if len(chain) > maxClientRedirects {
+			fmt.Printf("Too many redirects from %s, stopping at %s\n", chain[0], from)
+			return
+		}
+
+		r.Ctx.Put(redirectChainKey, append(chain, next))
+		fmt.Printf("Found %s redirect to: %s\n", kind, next)
+		err = c.Request("GET", next, nil, r.Ctx, nil)
+		if errors.Is(err, colly.ErrAlreadyVisited) {
+			// Clones share the visited store, so a target crawled earlier in
+			// this run is not fetched again but is still where the page ends up
+			if onFinal != nil {
+				onFinal(next)
+			}
+			return
+		}
+		if err != nil {
+			fmt.Printf("Failed to follow redirect to %s: %v\n", next, err)
+		}
+	})
+}
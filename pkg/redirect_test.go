@@ -0,0 +1,58 @@
+package metrograph
+
+import "testing"
+
+func TestFindClientRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		target string
+		kind   string
+	}{
+		{
+			name:   "meta refresh",
+			body:   `<html><head><meta http-equiv="refresh" content="0; url=/series/?vista_series_id=HO00000123"></head></html>`,
+			target: "/series/?vista_series_id=HO00000123",
+			kind:   "meta refresh",
+		},
+		{
+			name:   "meta refresh with entities",
+			body:   `<meta content="0;URL='/series/?a=1&amp;b=2'" http-equiv="Refresh">`,
+			target: "/series/?a=1&b=2",
+			kind:   "meta refresh",
+		},
+		{
+			name:   "location.replace in a script",
+			body:   `<script type="text/javascript">window.location.replace("https://metrograph.com/series/new/");</script>`,
+			target: "https://metrograph.com/series/new/",
+			kind:   "JavaScript",
+		},
+		{
+			name:   "location.href assignment in a script",
+			body:   "<script>\n  if (true) { window.location.href = '/series/moved/'; }\n</script>",
+			target: "/series/moved/",
+			kind:   "JavaScript",
+		},
+		{
+			name: "inline JavaScript outside a script",
+			body: `<p>Paste window.location.href = '/elsewhere/' into the console</p>`,
+		},
+		{
+			name: "attribute named location",
+			body: `<div data-location="/theater/"></div><script>var location = "/theater/";</script>`,
+		},
+		{
+			name: "no redirect",
+			body: `<html><body><h1>Series</h1></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, kind, ok := findClientRedirect([]byte(tt.body))
+			if ok != (tt.target != "") || target != tt.target || kind != tt.kind {
+				t.Errorf("findClientRedirect = %q, %q, %v, want %q, %q", target, kind, ok, tt.target, tt.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package metrograph
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rules decides which series and films are sent to Radarr and made into
+// collections, on top of the eligibility policy. Include lists, when set,
+// admit only what they match; excludes always win.
+type Rules struct {
+	Series SeriesRules `yaml:"series"`
+	Films  FilmRules   `yaml:"films"`
+}
+
+type SeriesRules struct {
+	IncludeIDs   []string `yaml:"include_ids"`   // Vista series IDs
+	ExcludeIDs   []string `yaml:"exclude_ids"`   // Vista series IDs
+	IncludeNames []string `yaml:"include_names"` // Regular expressions on the series name
+	ExcludeNames []string `yaml:"exclude_names"` // Regular expressions on the series name
+}
+
+// FilmRules filters films within a series. A film missing an attribute passes
+// its range, but not an include list. Zero bounds are unset.
+type FilmRules struct {
+	MinYear          int      `yaml:"min_year"`
+	MaxYear          int      `yaml:"max_year"`
+	MinRuntime       int      `yaml:"min_runtime"` // Minutes
+	MaxRuntime       int      `yaml:"max_runtime"` // Minutes
+	IncludeDirectors []string `yaml:"include_directors"`
+	ExcludeDirectors []string `yaml:"exclude_directors"`
+	IncludeFormats   []string `yaml:"include_formats"` // As parsed into FilmMetadata.Formats, e.g. "35mm"
+	ExcludeFormats   []string `yaml:"exclude_formats"`
+}
+
+// RuleSet is Rules with its regular expressions compiled. A nil *RuleSet
+// lets everything through.
+type RuleSet struct {
+	rules        Rules
+	includeNames []*regexp.Regexp
+	excludeNames []*regexp.Regexp
+}
+
+func NewRuleSet(rules Rules) (*RuleSet, error) {
+	rs := &RuleSet{rules: rules}
+
+	var err error
+	if rs.includeNames, err = compilePatterns("rules.series.include_names", rules.Series.IncludeNames); err != nil {
+		return nil, err
+	}
+	if rs.excludeNames, err = compilePatterns("rules.series.exclude_names", rules.Series.ExcludeNames); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func compilePatterns(setting string, patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %w", p, setting, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// seriesExclusion returns why a series is filtered out, or "" if it is kept.
+func (rs *RuleSet) seriesExclusion(seriesID string, s Series) string {
+	r := rs.rules.Series
+	if containsString(r.ExcludeIDs, seriesID) {
+		return "series ID in exclude_ids"
+	}
+	for _, re := range rs.excludeNames {
+		if re.MatchString(s.Name) {
+			return fmt.Sprintf("name matches exclude_names %q", re)
+		}
+	}
+
+	if len(r.IncludeIDs) == 0 && len(rs.includeNames) == 0 {
+		return ""
+	}
+	if containsString(r.IncludeIDs, seriesID) {
+		return ""
+	}
+	for _, re := range rs.includeNames {
+		if re.MatchString(s.Name) {
+			return ""
+		}
+	}
+	return "not matched by include_ids or include_names"
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// filmExclusion returns why a film is filtered out, or "" if it is kept.
+func (rs *RuleSet) filmExclusion(f Film) string {
+	r := rs.rules.Films
+
+	if f.Year > 0 {
+		if r.MinYear > 0 && f.Year < r.MinYear {
+			return fmt.Sprintf("year %d before min_year %d", f.Year, r.MinYear)
+		}
+		if r.MaxYear > 0 && f.Year > r.MaxYear {
+			return fmt.Sprintf("year %d after max_year %d", f.Year, r.MaxYear)
+		}
+	}
+
+	if runtime := f.runtimeMinutes(); runtime > 0 {
+		if r.MinRuntime > 0 && runtime < r.MinRuntime {
+			return fmt.Sprintf("runtime %d below min_runtime %d", runtime, r.MinRuntime)
+		}
+		if r.MaxRuntime > 0 && runtime > r.MaxRuntime {
+			return fmt.Sprintf("runtime %d above max_runtime %d", runtime, r.MaxRuntime)
+		}
+	}
+
+	directors := f.directors()
+	if d := firstMatch(directors, r.ExcludeDirectors, normalizeTitle); d != "" {
+		return fmt.Sprintf("director %s in exclude_directors", d)
+	}
+	if len(r.IncludeDirectors) > 0 && firstMatch(directors, r.IncludeDirectors, normalizeTitle) == "" {
+		return "director not in include_directors"
+	}
+
+	var formats []string
+	if f.Metadata != nil {
+		formats = f.Metadata.Formats
+	}
+	if format := firstMatch(formats, r.ExcludeFormats, normalizeFormat); format != "" {
+		return fmt.Sprintf("format %s in exclude_formats", format)
+	}
+	if len(r.IncludeFormats) > 0 && firstMatch(formats, r.IncludeFormats, normalizeFormat) == "" {
+		return "format not in include_formats"
+	}
+
+	return ""
+}
+
+func (f Film) directors() []string {
+	if f.Metadata != nil && len(f.Metadata.Directors) > 0 {
+		return f.Metadata.Directors
+	}
+	if f.Director == "" {
+		return nil
+	}
+	return strings.Split(f.Director, ", ")
+}
+
+// firstMatch returns the first of values found in list, comparing both after
+// normalize.
+func firstMatch(values []string, list []string, normalize func(string) string) string {
+	for _, v := range values {
+		for _, item := range list {
+			if normalize(v) == normalize(item) {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func normalizeFormat(format string) string {
+	return strings.ReplaceAll(strings.ToLower(format), " ", "")
+}
+
+// RuleExclusion is a series, or a film within one, that the rules filtered.
+type RuleExclusion struct {
+	SeriesID   string
+	SeriesName string
+	Film       string // Empty when the whole series was filtered
+	Reason     string
+}
+
+type RuleReport struct {
+	Exclusions []RuleExclusion
+	Series     int // Series kept
+	Films      int // Films kept in those series
+}
+
+// Apply returns a copy of data without the series and films the rules filter
+// out, and a report of what was removed. data is not modified.
+func (rs *RuleSet) Apply(data ScrapedData) (ScrapedData, RuleReport) {
+	var report RuleReport
+	if rs == nil {
+		for _, s := range data.Collections {
+			report.Series++
+			report.Films += len(s.Movies)
+		}
+		return data, report
+	}
+
+	filtered := data
+	filtered.Collections = make(map[string]Series)
+	for id, s := range data.Collections {
+		if reason := rs.seriesExclusion(id, s); reason != "" {
+			report.Exclusions = append(report.Exclusions, RuleExclusion{SeriesID: id, SeriesName: s.Name, Reason: reason})
+			continue
+		}
+
+		movies := make([]Film, 0, len(s.Movies))
+		for _, f := range s.Movies {
+			if reason := rs.filmExclusion(f); reason != "" {
+				report.Exclusions = append(report.Exclusions, RuleExclusion{SeriesID: id, SeriesName: s.Name, Film: f.Title, Reason: reason})
+				continue
+			}
+			movies = append(movies, f)
+		}
+		s.Movies = movies
+		filtered.Collections[id] = s
+		report.Series++
+		report.Films += len(movies)
+	}
+
+	sort.Slice(report.Exclusions, func(i, j int) bool {
+		a, b := report.Exclusions[i], report.Exclusions[j]
+		if a.SeriesName != b.SeriesName {
+			return a.SeriesName < b.SeriesName
+		}
+		return a.Film < b.Film
+	})
+	return filtered, report
+}
+
+// PrintSummary writes one line about what the rules removed, if anything.
+func (r RuleReport) PrintSummary() {
+	series, films := r.counts()
+	if series+films > 0 {
+		fmt.Printf("Rules filtered %d series and %d films\n", series, films)
+	}
+}
+
+func (r RuleReport) counts() (series int, films int) {
+	for _, e := range r.Exclusions {
+		if e.Film == "" {
+			series++
+		} else {
+			films++
+		}
+	}
+	return series, films
+}
+
+// WriteText lists everything the rules filtered, for a dry run.
+func (r RuleReport) WriteText(w io.Writer) {
+	series, films := r.counts()
+	fmt.Fprintf(w, "Rules keep %d series with %d films, and filter %d series and %d films\n", r.Series, r.Films, series, films)
+
+	for _, e := range r.Exclusions {
+		if e.Film == "" {
+			fmt.Fprintf(w, "- series %s (%s): %s\n", e.SeriesName, e.SeriesID, e.Reason)
+		} else {
+			fmt.Fprintf(w, "    - %s in %s: %s\n", e.Film, e.SeriesName, e.Reason)
+		}
+	}
+}
+
+// DryRun writes what the rules filter from data, and which series the policy
+// drops because of it, without touching Radarr or Agregarr.
+func (rs *RuleSet) DryRun(w io.Writer, data ScrapedData, policy EligibilityPolicy) {
+	filtered, report := rs.Apply(data)
+	report.WriteText(w)
+
+	var dropped []string
+	for id, s := range filtered.Collections {
+		if policy.Evaluate(id, data.Collections[id]).Eligible && !policy.Evaluate(id, s).Eligible {
+			dropped = append(dropped, fmt.Sprintf("%s (%s)", s.Name, id))
+		}
+	}
+	sort.Strings(dropped)
+	for _, d := range dropped {
+		fmt.Fprintf(w, "! series %s is no longer eligible once its films are filtered\n", d)
+	}
+}
@@ -0,0 +1,119 @@
+package metrograph
+
+import (
+	"testing"
+)
+
+func TestRuleSetSeriesExclusion(t *testing.T) {
+	series := Series{Name: "Kids Matinee: Studio Ghibli"}
+
+	tests := []struct {
+		name   string
+		rules  SeriesRules
+		reason string
+	}{
+		{"no rules", SeriesRules{}, ""},
+		{"excluded by ID", SeriesRules{ExcludeIDs: []string{"1"}}, "series ID in exclude_ids"},
+		{"excluded by name", SeriesRules{ExcludeNames: []string{"(?i)matinee"}}, `name matches exclude_names "(?i)matinee"`},
+		{"included by ID", SeriesRules{IncludeIDs: []string{"1"}}, ""},
+		{"included by name", SeriesRules{IncludeNames: []string{"Ghibli"}}, ""},
+		{"not included", SeriesRules{IncludeIDs: []string{"2"}, IncludeNames: []string{"Akerman"}}, "not matched by include_ids or include_names"},
+		{"exclude ID wins over include ID", SeriesRules{IncludeIDs: []string{"1"}, ExcludeIDs: []string{"1"}}, "series ID in exclude_ids"},
+		{"exclude name wins over include ID", SeriesRules{IncludeIDs: []string{"1"}, ExcludeNames: []string{"Kids"}}, `name matches exclude_names "Kids"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := NewRuleSet(Rules{Series: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rs.seriesExclusion("1", series); got != tt.reason {
+				t.Errorf("seriesExclusion = %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRuleSetFilmExclusion(t *testing.T) {
+	jeanne := Film{
+		Title:    "Jeanne Dielman, 23 quai du Commerce, 1080 Bruxelles",
+		Director: "Chantal Akerman",
+		Year:     1975,
+		Metadata: &FilmMetadata{Directors: []string{"Chantal Akerman"}, Runtime: 201, Formats: []string{"35mm"}},
+	}
+	bare := Film{Title: "Untitled short"}
+
+	tests := []struct {
+		name   string
+		rules  FilmRules
+		film   Film
+		reason string
+	}{
+		{"no rules", FilmRules{}, jeanne, ""},
+		{"before min year", FilmRules{MinYear: 1980}, jeanne, "year 1975 before min_year 1980"},
+		{"after max year", FilmRules{MaxYear: 1970}, jeanne, "year 1975 after max_year 1970"},
+		{"within years", FilmRules{MinYear: 1970, MaxYear: 1980}, jeanne, ""},
+		{"below min runtime", FilmRules{MinRuntime: 240}, jeanne, "runtime 201 below min_runtime 240"},
+		{"above max runtime", FilmRules{MaxRuntime: 180}, jeanne, "runtime 201 above max_runtime 180"},
+		{"unknown year and runtime pass ranges", FilmRules{MinYear: 1980, MinRuntime: 60}, bare, ""},
+		{"excluded director", FilmRules{ExcludeDirectors: []string{"chantal akerman"}}, jeanne, "director Chantal Akerman in exclude_directors"},
+		{"included director", FilmRules{IncludeDirectors: []string{"Chantal Akerman", "Agnès Varda"}}, jeanne, ""},
+		{"director not included", FilmRules{IncludeDirectors: []string{"Agnès Varda"}}, jeanne, "director not in include_directors"},
+		{"unknown director fails include list", FilmRules{IncludeDirectors: []string{"Agnès Varda"}}, bare, "director not in include_directors"},
+		{"excluded format", FilmRules{ExcludeFormats: []string{"35 MM"}}, jeanne, "format 35mm in exclude_formats"},
+		{"included format", FilmRules{IncludeFormats: []string{"35mm", "16mm"}}, jeanne, ""},
+		{"format not included", FilmRules{IncludeFormats: []string{"DCP"}}, jeanne, "format not in include_formats"},
+		{"exclude wins over include", FilmRules{IncludeFormats: []string{"35mm"}, ExcludeFormats: []string{"35mm"}}, jeanne, "format 35mm in exclude_formats"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := NewRuleSet(Rules{Films: tt.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rs.filmExclusion(tt.film); got != tt.reason {
+				t.Errorf("filmExclusion = %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRuleSetApply(t *testing.T) {
+	data := ScrapedData{Collections: map[string]Series{
+		"1": {Name: "Akerman", Movies: []Film{{Title: "Jeanne Dielman", Year: 1975}, {Title: "Saute ma ville", Year: 1968}}},
+		"2": {Name: "Members Only", Movies: []Film{{Title: "Carol", Year: 2015}}},
+	}}
+
+	rs, err := NewRuleSet(Rules{
+		Series: SeriesRules{ExcludeNames: []string{"(?i)members"}},
+		Films:  FilmRules{MinYear: 1970},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered, report := rs.Apply(data)
+	if _, ok := filtered.Collections["2"]; ok {
+		t.Error("excluded series kept")
+	}
+	if films := filtered.Collections["1"].Movies; len(films) != 1 || films[0].Title != "Jeanne Dielman" {
+		t.Errorf("kept films = %+v, want only Jeanne Dielman", films)
+	}
+	if len(data.Collections["1"].Movies) != 2 {
+		t.Error("Apply modified its input")
+	}
+	if series, films := report.counts(); report.Series != 1 || report.Films != 1 || series != 1 || films != 1 {
+		t.Errorf("report kept %d series and %d films, filtered %d and %d; want 1 of each", report.Series, report.Films, series, films)
+	}
+
+	var nilRules *RuleSet
+	if kept, report := nilRules.Apply(data); len(kept.Collections) != 2 || report.Films != 3 {
+		t.Errorf("nil RuleSet filtered something: %d series, %d films", len(kept.Collections), report.Films)
+	}
+
+	if _, err := NewRuleSet(Rules{Series: SeriesRules{IncludeNames: []string{"("}}}); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
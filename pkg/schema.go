@@ -0,0 +1,320 @@
+package metrograph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SnapshotSchema returns a JSON Schema for the current snapshot format,
+// generated from the json tags on ScrapedData and the types it holds.
+func SnapshotSchema() map[string]any {
+	g := schemaGenerator{defs: make(map[string]any)}
+	root := g.structSchema(reflect.TypeOf(ScrapedData{}))
+
+	root["$schema"] = jsonSchemaDialect
+	root["title"] = "Metrograph watchlist snapshot"
+	root["properties"].(map[string]any)["schema_version"] = map[string]any{
+		"type":  "integer",
+		"const": SnapshotSchemaVersion,
+	}
+	root["$defs"] = g.defs
+	return root
+}
+
+// WriteSnapshotSchema writes SnapshotSchema as indented JSON.
+func WriteSnapshotSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(SnapshotSchema())
+}
+
+type schemaGenerator struct {
+	defs map[string]any // Named struct types, referenced as #/$defs/<name>
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	sort.Strings(required)
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema describes how encoding/json writes a value of type t. Nil
+// pointers, slices and maps are written as null.
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return map[string]any{"anyOf": []any{g.typeSchema(t.Elem()), map[string]any{"type": "null"}}}
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // Guards against recursive types
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{"type": []any{"array", "null"}, "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": []any{"object", "null"}, "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// schemaValidator checks a decoded document against the subset of JSON Schema
+// that SnapshotSchema generates.
+type schemaValidator struct {
+	defs     map[string]any
+	problems []string
+}
+
+func (v *schemaValidator) fail(path string, format string, args ...any) {
+	if path == "" {
+		path = "/"
+	}
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(value any, schema map[string]any, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, _ := v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		v.validate(value, def, path)
+		return
+	}
+
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, option := range anyOf {
+			sub := schemaValidator{defs: v.defs}
+			sub.validate(value, option.(map[string]any), path)
+			if len(sub.problems) == 0 {
+				return
+			}
+		}
+		v.fail(path, "does not match any allowed type")
+		return
+	}
+
+	if t, ok := schema["type"]; ok && !matchesSchemaType(value, t) {
+		v.fail(path, "expected %v, got %s", t, jsonTypeName(value))
+		return
+	}
+
+	if c, ok := schema["const"]; ok && fmt.Sprint(value) != fmt.Sprint(c) {
+		v.fail(path, "expected %v, got %v", c, value)
+	}
+
+	if schema["format"] == "date-time" {
+		if s, ok := value.(string); ok {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				v.fail(path, "invalid date-time %q", s)
+			}
+		}
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		v.validateObject(val, schema, path)
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				v.validate(item, items, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(obj map[string]any, schema map[string]any, path string) {
+	properties, _ := schema["properties"].(map[string]any)
+
+	required, _ := schema["required"].([]any)
+	for _, name := range required {
+		if _, ok := obj[name.(string)]; !ok {
+			v.fail(path, "missing required property %q", name)
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := path + "/" + k
+		if prop, ok := properties[k].(map[string]any); ok {
+			v.validate(obj[k], prop, childPath)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				v.fail(path, "unknown property %q", k)
+			}
+		case map[string]any:
+			v.validate(obj[k], extra, childPath)
+		}
+	}
+}
+
+func matchesSchemaType(value any, t any) bool {
+	if types, ok := t.([]any); ok {
+		for _, option := range types {
+			if matchesSchemaType(value, option) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch t {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// SnapshotValidation is the outcome of checking a snapshot file.
+type SnapshotValidation struct {
+	Version  int      // Schema version the file was written with
+	Problems []string // Empty when the file is valid
+}
+
+// ValidateSnapshot checks a snapshot file against SnapshotSchema. Older files
+// are migrated first, so they are checked as LoadScrapedData would read them.
+func ValidateSnapshot(jsonFile string) (SnapshotValidation, error) {
+	var result SnapshotValidation
+
+	data, err := readSnapshotFile(jsonFile)
+	if err != nil {
+		return result, fmt.Errorf("failed to read JSON file %s: %w", jsonFile, err)
+	}
+	doc, err := decodeSnapshotDocument(data)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse JSON file %s: %w", jsonFile, err)
+	}
+	result.Version, err = upgradeSnapshotDocument(doc)
+	if err != nil {
+		result.Problems = append(result.Problems, err.Error())
+		return result, nil
+	}
+
+	// Round-trip the schema so it has the same shape as a decoded document
+	raw, err := json.Marshal(SnapshotSchema())
+	if err != nil {
+		return result, fmt.Errorf("failed to encode schema: %w", err)
+	}
+	schema, err := decodeSnapshotDocument(raw)
+	if err != nil {
+		return result, fmt.Errorf("failed to decode schema: %w", err)
+	}
+
+	v := schemaValidator{defs: schema["$defs"].(map[string]any)}
+	v.validate(doc, schema, "")
+	result.Problems = v.problems
+	return result, nil
+}
+
+// WriteSnapshotSchemaFile writes the schema to path, or stdout when path is
+// empty.
+func WriteSnapshotSchemaFile(path string) error {
+	if path == "" {
+		return WriteSnapshotSchema(os.Stdout)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSnapshotSchema(&buf); err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("Wrote snapshot schema version %d to %s\n", SnapshotSchemaVersion, path)
+	return nil
+}
@@ -0,0 +1,90 @@
+package metrograph
+
+import "fmt"
+
+// Bump when the default selectors change, so configs pinned to an older set
+// get a warning
+const defaultSelectorsVersion = 1
+
+// Selectors locates everything the crawler reads on Metrograph's pages. Empty
+// fields fall back to DefaultSelectors.
+type Selectors struct {
+	Version int `yaml:"version"`
+
+	// Series index at /series/
+	SeriesRow  string `yaml:"series_row"`
+	SeriesLink string `yaml:"series_link"` // Inside SeriesRow, wraps the series link
+
+	// Series page
+	Film              string `yaml:"film"`
+	FilmTitle         string `yaml:"film_title"`    // Inside Film
+	FilmMetadata      string `yaml:"film_metadata"` // Inside Film
+	FilmLink          string `yaml:"film_link"`     // Inside Film, href is the film page
+	SeriesDescription string `yaml:"series_description"`
+	SeriesDates       string `yaml:"series_dates"`
+	SeriesImage       string `yaml:"series_image"` // content attribute is the image URL
+	SeriesCurator     string `yaml:"series_curator"`
+
+	// Film page
+	FilmPageSynopsis string `yaml:"film_page_synopsis"`
+	FilmPageMetadata string `yaml:"film_page_metadata"`
+	FilmPageDay      string `yaml:"film_page_day"`
+	FilmPageDate     string `yaml:"film_page_date"` // Inside FilmPageDay
+	FilmPageTime     string `yaml:"film_page_time"` // Inside FilmPageDay, href is the ticket link
+}
+
+// DefaultSelectors matches the Metrograph site as of the last selector update.
+func DefaultSelectors() Selectors {
+	return Selectors{
+		Version: defaultSelectorsVersion,
+
+		SeriesRow:  ".row",
+		SeriesLink: ".movie_title",
+
+		Film:              ".item",
+		FilmTitle:         ".title",
+		FilmMetadata:      ".film-metadata",
+		FilmLink:          "a",
+		SeriesDescription: ".series-description",
+		SeriesDates:       ".series-dates",
+		SeriesImage:       `meta[property="og:image"]`,
+		SeriesCurator:     ".series-curator",
+
+		FilmPageSynopsis: ".film-description",
+		FilmPageMetadata: ".film-metadata",
+		FilmPageDay:      ".showtimes .showtime-day",
+		FilmPageDate:     ".date",
+		FilmPageTime:     "a",
+	}
+}
+
+// withDefaults fills empty selectors from DefaultSelectors and warns when
+// the configured set was written for older defaults.
+func (s Selectors) withDefaults() Selectors {
+	defaults := DefaultSelectors()
+	if s.Version != 0 && s.Version < defaults.Version {
+		fmt.Printf("Warning: configured selectors are version %d but the defaults are version %d; check them against the site\n", s.Version, defaults.Version)
+	}
+
+	fill := func(sel *string, def string) {
+		if *sel == "" {
+			*sel = def
+		}
+	}
+	fill(&s.SeriesRow, defaults.SeriesRow)
+	fill(&s.SeriesLink, defaults.SeriesLink)
+	fill(&s.Film, defaults.Film)
+	fill(&s.FilmTitle, defaults.FilmTitle)
+	fill(&s.FilmMetadata, defaults.FilmMetadata)
+	fill(&s.FilmLink, defaults.FilmLink)
+	fill(&s.SeriesDescription, defaults.SeriesDescription)
+	fill(&s.SeriesDates, defaults.SeriesDates)
+	fill(&s.SeriesImage, defaults.SeriesImage)
+	fill(&s.SeriesCurator, defaults.SeriesCurator)
+	fill(&s.FilmPageSynopsis, defaults.FilmPageSynopsis)
+	fill(&s.FilmPageMetadata, defaults.FilmPageMetadata)
+	fill(&s.FilmPageDay, defaults.FilmPageDay)
+	fill(&s.FilmPageDate, defaults.FilmPageDate)
+	fill(&s.FilmPageTime, defaults.FilmPageTime)
+	return s
+}
@@ -0,0 +1,136 @@
+package metrograph
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+var (
+	dateRangeSplitRe = regexp.MustCompile(`\s*(?:–|—|-|\bthrough\b|\bto\b|\buntil\b)\s*`)
+	dateRangeYearRe  = regexp.MustCompile(`\b(19|20)\d\d\b`)
+	dateRangeLeadRe  = regexp.MustCompile(`(?i)^(opens|opening|starts|from|now playing|now showing)\s+`)
+	curatorRe        = regexp.MustCompile(`(?i)(?:programmed|curated|selected|presented)\s+by\s+([^.\n]+)`)
+)
+
+// parseDateRange parses a series run such as "January 3 – January 20, 2026",
+// "Jan 3–20" or "Opens February 7". A single date gives a zero end.
+func parseDateRange(text string, now time.Time) (time.Time, time.Time, bool) {
+	text = dateRangeLeadRe.ReplaceAllString(strings.TrimSpace(text), "")
+	parts := dateRangeSplitRe.Split(text, 2)
+
+	left := strings.TrimSpace(parts[0])
+	right := ""
+	if len(parts) > 1 {
+		right = strings.TrimSpace(parts[1])
+	}
+
+	// "Jan 3–20": the end borrows the start's month
+	if right != "" && right[0] >= '0' && right[0] <= '9' && !strings.Contains(right, "/") {
+		if fields := strings.Fields(weekdayPrefixRe.ReplaceAllString(left, "")); len(fields) > 0 {
+			right = fields[0] + " " + right
+		}
+	}
+
+	// "January 3 – January 20, 2026": the start borrows the end's year
+	if year := dateRangeYearRe.FindString(right); year != "" && !dateRangeYearRe.MatchString(left) {
+		left = strings.TrimSuffix(left, ",") + " " + year
+	}
+
+	start, ok := parseDay(left, now)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	if right == "" {
+		return start, time.Time{}, true
+	}
+
+	end, ok := parseDay(right, now)
+	if !ok {
+		return start, time.Time{}, true
+	}
+	if end.Before(start) {
+		// A run over New Year where the start borrowed the end's year
+		start = start.AddDate(-1, 0, 0)
+	}
+	return start, end, true
+}
+
+// collectSeriesMetadata registers callbacks on a series page collector that
+// fill in the description, run dates, image and curator of series id.
+func collectSeriesMetadata(mc *colly.Collector, sel Selectors, results *crawlResults, id string) {
+	now := time.Now()
+
+	mc.OnHTML(sel.SeriesDescription, func(h *colly.HTMLElement) {
+		results.update(id, func(s *Series) {
+			if s.Description == "" {
+				s.Description = strings.TrimSpace(h.Text)
+				if s.Curator == "" {
+					if m := curatorRe.FindStringSubmatch(s.Description); m != nil {
+						s.Curator = strings.TrimSpace(m[1])
+					}
+				}
+			}
+		})
+	})
+
+	mc.OnHTML(sel.SeriesDates, func(h *colly.HTMLElement) {
+		start, end, ok := parseDateRange(h.Text, now)
+		if !ok {
+			fmt.Printf("Could not parse series dates %q\n", strings.TrimSpace(h.Text))
+			return
+		}
+		results.update(id, func(s *Series) {
+			if s.StartDate == "" {
+				s.StartDate = start.Format(snapshotDateFormat)
+				if !end.IsZero() {
+					s.EndDate = end.Format(snapshotDateFormat)
+				}
+			}
+		})
+	})
+
+	mc.OnHTML(sel.SeriesImage, func(h *colly.HTMLElement) {
+		results.update(id, func(s *Series) {
+			if s.ImageURL == "" {
+				s.ImageURL = absoluteURL(h.Attr("content"))
+			}
+		})
+	})
+
+	mc.OnHTML(sel.SeriesCurator, func(h *colly.HTMLElement) {
+		credit := strings.TrimSpace(h.Text)
+		if m := curatorRe.FindStringSubmatch(credit); m != nil {
+			credit = strings.TrimSpace(m[1])
+		}
+		if credit != "" {
+			results.update(id, func(s *Series) {
+				s.Curator = credit
+			})
+		}
+	})
+}
+
+// collectionDescription summarises a series for its Agregarr collection.
+func (s Series) collectionDescription() string {
+	var parts []string
+
+	if start, err := time.Parse(snapshotDateFormat, s.StartDate); err == nil {
+		run := start.Format("January 2, 2006")
+		if end, err := time.Parse(snapshotDateFormat, s.EndDate); err == nil {
+			run += " – " + end.Format("January 2, 2006")
+		}
+		parts = append(parts, run+" at Metrograph.")
+	}
+	if s.Curator != "" && !curatorRe.MatchString(s.Description) {
+		parts = append(parts, "Programmed by "+s.Curator+".")
+	}
+	if s.Description != "" {
+		parts = append(parts, s.Description)
+	}
+
+	return strings.Join(parts, " ")
+}
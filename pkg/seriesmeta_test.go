@@ -0,0 +1,46 @@
+package metrograph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	now := time.Date(2025, time.December, 15, 12, 0, 0, 0, metrographLocation())
+
+	tests := []struct {
+		text  string
+		start string
+		end   string
+		ok    bool
+	}{
+		{"January 3 – January 20, 2026", "2026-01-03", "2026-01-20", true},
+		{"December 27 – January 4, 2026", "2025-12-27", "2026-01-04", true},
+		{"December 27, 2025 – January 4, 2026", "2025-12-27", "2026-01-04", true},
+		{"Dec 27 – Jan 4", "2025-12-27", "2026-01-04", true},
+		{"Jan 3–20", "2026-01-03", "2026-01-20", true},
+		{"Fri, Feb 6 through Sun, Feb 8", "2026-02-06", "2026-02-08", true},
+		{"Opens February 7", "2026-02-07", "", true},
+		{"Coming soon", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			start, end, ok := parseDateRange(tt.text, now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+
+			gotEnd := ""
+			if !end.IsZero() {
+				gotEnd = end.Format(snapshotDateFormat)
+			}
+			if got := start.Format(snapshotDateFormat); got != tt.start || gotEnd != tt.end {
+				t.Errorf("parseDateRange(%q) = %s – %s, want %s – %s", tt.text, got, gotEnd, tt.start, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package metrograph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSnapshotDir = "."
+	snapshotDateFormat = "2006-01-02"
+	snapshotExt        = ".json"
+	snapshotGzipExt    = ".gz"
+	snapshotLatestFile = "latest" // Holds the file name of the newest snapshot
+)
+
+// SnapshotConfig says where JSON snapshots live and how many are kept. Keep
+// and CompressAfter count snapshots, newest first; zero disables them.
+type SnapshotConfig struct {
+	Dir           string
+	Keep          int // Delete snapshots older than the newest Keep
+	CompressAfter int // Gzip snapshots older than the newest CompressAfter
+}
+
+func (c SnapshotConfig) withDefaults() SnapshotConfig {
+	if c.Dir == "" {
+		c.Dir = defaultSnapshotDir
+	}
+	return c
+}
+
+// snapshotFile is one <date>.json or <date>.json.gz file in the snapshot dir.
+type snapshotFile struct {
+	name string
+	date time.Time
+}
+
+func (f snapshotFile) compressed() bool {
+	return strings.HasSuffix(f.name, snapshotGzipExt)
+}
+
+// listSnapshots returns the snapshots in dir, newest first. Other files are
+// ignored, and a missing dir has no snapshots.
+func listSnapshots(dir string) ([]snapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot dir %s: %w", dir, err)
+	}
+
+	var files []snapshotFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		base := strings.TrimSuffix(e.Name(), snapshotGzipExt)
+		if !strings.HasSuffix(base, snapshotExt) {
+			continue
+		}
+		date, err := time.Parse(snapshotDateFormat, strings.TrimSuffix(base, snapshotExt))
+		if err != nil {
+			continue
+		}
+		files = append(files, snapshotFile{name: e.Name(), date: date})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].date.After(files[j].date) })
+	return files, nil
+}
+
+// FindSnapshot returns the path of the snapshot back runs before the one the
+// latest pointer names, or "" when there is none. Without a pointer the
+// newest snapshot counts as latest.
+func (c SnapshotConfig) FindSnapshot(back int) (string, error) {
+	c = c.withDefaults()
+	files, err := listSnapshots(c.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	start := 0
+	if name, err := os.ReadFile(filepath.Join(c.Dir, snapshotLatestFile)); err == nil {
+		latest := strings.TrimSpace(string(name))
+		for i, f := range files {
+			if f.name == latest || f.name == latest+snapshotGzipExt {
+				start = i
+				break
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to read latest snapshot pointer: %w", err)
+	}
+
+	if start+back >= len(files) {
+		return "", nil
+	}
+	return filepath.Join(c.Dir, files[start+back].name), nil
+}
+
+// readSnapshotFile reads a snapshot, decompressing it if it was gzipped by
+// the retention policy.
+func readSnapshotFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.HasSuffix(path, snapshotGzipExt) {
+		return data, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so an interrupted write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeSnapshot writes data as <date>.json in the snapshot dir and points
+// latest at it, then applies the retention policy.
+func (c SnapshotConfig) writeSnapshot(data ScrapedData) (string, error) {
+	c = c.withDefaults()
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot dir %s: %w", c.Dir, err)
+	}
+
+	data.SchemaVersion = SnapshotSchemaVersion
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	name := data.Date + snapshotExt
+	path := filepath.Join(c.Dir, name)
+	if err := writeFileAtomic(path, jsonData, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// A compressed copy from an earlier run today is now stale
+	if err := os.Remove(path + snapshotGzipExt); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to remove %s: %w", path+snapshotGzipExt, err)
+	}
+	if err := writeFileAtomic(filepath.Join(c.Dir, snapshotLatestFile), []byte(name+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to update latest snapshot pointer: %w", err)
+	}
+
+	return path, c.applyRetention()
+}
+
+// applyRetention deletes snapshots beyond Keep and compresses those beyond
+// CompressAfter. The newest snapshot is never touched.
+func (c SnapshotConfig) applyRetention() error {
+	files, err := listSnapshots(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		if i == 0 {
+			continue
+		}
+		path := filepath.Join(c.Dir, f.name)
+
+		if c.Keep > 0 && i >= c.Keep {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to prune snapshot %s: %w", path, err)
+			}
+			fmt.Printf("Pruned snapshot %s\n", path)
+			continue
+		}
+		if c.CompressAfter > 0 && i >= c.CompressAfter && !f.compressed() {
+			if err := compressSnapshot(path); err != nil {
+				return err
+			}
+			fmt.Printf("Compressed snapshot %s\n", path)
+		}
+	}
+	return nil
+}
+
+func compressSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("failed to compress snapshot %s: %w", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress snapshot %s: %w", path, err)
+	}
+
+	if err := writeFileAtomic(path+snapshotGzipExt, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path+snapshotGzipExt, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package metrograph
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Snapshot references accepted wherever a JSON file is: "latest" is the most
+// recent run in the store or snapshot dir, "latest~N" the run N before it.
+const (
+	SnapshotLatest         = "latest"
+	snapshotLatestSep      = "~"
+	storeSourceCrawl       = "crawl"
+	storeSourceImportLabel = "import:"
+)
+
+// Sync action targets and kinds recorded by RecordSyncAction
+const (
+	SyncTargetRadarr   = "radarr"
+	SyncTargetAgregarr = "agregarr"
+
+	SyncActionCreateTag        = "create_tag"
+	SyncActionDeleteTag        = "delete_tag"
+	SyncActionAddMovie         = "add_movie"
+	SyncActionCreateCollection = "create_collection"
+	SyncActionDeleteCollection = "delete_collection"
+)
+
+// storeSchema is applied on every open, so it must stay idempotent.
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	date       TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	source     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS series (
+	run_id    INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+	series_id TEXT NOT NULL,
+	name      TEXT NOT NULL,
+	url       TEXT NOT NULL,
+	data      TEXT NOT NULL, -- Series without Movies, as JSON
+	PRIMARY KEY (run_id, series_id)
+);
+
+CREATE TABLE IF NOT EXISTS films (
+	run_id    INTEGER NOT NULL,
+	series_id TEXT NOT NULL,
+	position  INTEGER NOT NULL,
+	film_id   TEXT NOT NULL,
+	title     TEXT NOT NULL,
+	director  TEXT NOT NULL,
+	year      INTEGER NOT NULL,
+	data      TEXT NOT NULL, -- Film as JSON
+	PRIMARY KEY (run_id, series_id, position),
+	FOREIGN KEY (run_id, series_id) REFERENCES series(run_id, series_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS films_film_id ON films(film_id);
+
+CREATE TABLE IF NOT EXISTS matches (
+	run_id     INTEGER NOT NULL,
+	series_id  TEXT NOT NULL,
+	position   INTEGER NOT NULL,
+	film_id    TEXT NOT NULL,
+	tmdb_id    INTEGER NOT NULL,
+	imdb_id    TEXT NOT NULL,
+	confidence REAL NOT NULL,
+	reason     TEXT NOT NULL,
+	strategy   TEXT NOT NULL,
+	ignored    INTEGER NOT NULL,
+	PRIMARY KEY (run_id, series_id, position),
+	FOREIGN KEY (run_id, series_id, position) REFERENCES films(run_id, series_id, position) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS matches_tmdb_id ON matches(tmdb_id);
+
+CREATE TABLE IF NOT EXISTS sync_actions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id     INTEGER REFERENCES runs(id) ON DELETE SET NULL,
+	created_at TEXT NOT NULL,
+	target     TEXT NOT NULL,
+	action     TEXT NOT NULL,
+	series_id  TEXT NOT NULL,
+	tmdb_id    INTEGER NOT NULL,
+	detail     TEXT NOT NULL,
+	error      TEXT NOT NULL
+);
+`
+
+// Store keeps every crawl run, its series, films and matches, and what was
+// pushed to Radarr and Agregarr, in an embedded SQLite database.
+type Store struct {
+	path string
+	db   *sql.DB
+}
+
+// SyncAction is one change made in Radarr or Agregarr. Err is empty when
+// the change succeeded.
+type SyncAction struct {
+	Target   string
+	Action   string
+	SeriesID string
+	TMDBID   int
+	Detail   string
+	Err      error
+}
+
+// StoreRun summarises a run for listings.
+type StoreRun struct {
+	ID        int64
+	Date      string
+	CreatedAt time.Time
+	Source    string
+	Series    int
+	Films     int
+}
+
+// OpenStore opens or creates the database at path and applies the schema.
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", path, err)
+	}
+	// A single connection keeps PRAGMAs in effect and avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{"PRAGMA foreign_keys = ON", "PRAGMA journal_mode = WAL", storeSchema} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to initialise store %s: %w", path, err)
+		}
+	}
+
+	return &Store{path: path, db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveRun stores data as a new run and returns its ID.
+func (s *Store) SaveRun(data ScrapedData, source string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO runs (date, created_at, source) VALUES (?, ?, ?)`,
+		data.Date, time.Now().UTC().Format(time.RFC3339), source)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert run: %w", err)
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert run: %w", err)
+	}
+
+	for seriesID, series := range data.Collections {
+		meta := series
+		meta.Movies = nil
+		seriesJSON, err := json.Marshal(meta)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode series %s: %w", seriesID, err)
+		}
+		_, err = tx.Exec(`INSERT INTO series (run_id, series_id, name, url, data) VALUES (?, ?, ?, ?, ?)`,
+			runID, seriesID, series.Name, series.URL, string(seriesJSON))
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert series %s: %w", seriesID, err)
+		}
+
+		for i, f := range series.Movies {
+			filmJSON, err := json.Marshal(f)
+			if err != nil {
+				return 0, fmt.Errorf("failed to encode film %s: %w", f.Title, err)
+			}
+			_, err = tx.Exec(`INSERT INTO films (run_id, series_id, position, film_id, title, director, year, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				runID, seriesID, i, f.StableID(), f.Title, f.Director, f.Year, string(filmJSON))
+			if err != nil {
+				return 0, fmt.Errorf("failed to insert film %s: %w", f.Title, err)
+			}
+
+			if f.TMDBID == 0 && !f.Ignored {
+				continue
+			}
+			_, err = tx.Exec(`INSERT INTO matches (run_id, series_id, position, film_id, tmdb_id, imdb_id, confidence, reason, strategy, ignored) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				runID, seriesID, i, f.StableID(), f.TMDBID, f.IMDBID, f.Confidence, f.MatchReason, f.MatchStrategy, f.Ignored)
+			if err != nil {
+				return 0, fmt.Errorf("failed to insert match for %s: %w", f.Title, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit run: %w", err)
+	}
+	return runID, nil
+}
+
+// LoadRun reads a run back as a snapshot.
+func (s *Store) LoadRun(runID int64) (ScrapedData, error) {
+	data := ScrapedData{SchemaVersion: SnapshotSchemaVersion, Collections: make(map[string]Series), runID: runID}
+
+	err := s.db.QueryRow(`SELECT date FROM runs WHERE id = ?`, runID).Scan(&data.Date)
+	if errors.Is(err, sql.ErrNoRows) {
+		return data, fmt.Errorf("run %d not found in %s", runID, s.path)
+	}
+	if err != nil {
+		return data, fmt.Errorf("failed to read run %d: %w", runID, err)
+	}
+
+	rows, err := s.db.Query(`SELECT series_id, data FROM series WHERE run_id = ?`, runID)
+	if err != nil {
+		return data, fmt.Errorf("failed to read series of run %d: %w", runID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return data, fmt.Errorf("failed to read series of run %d: %w", runID, err)
+		}
+		var series Series
+		if err := json.Unmarshal([]byte(raw), &series); err != nil {
+			return data, fmt.Errorf("failed to decode series %s: %w", id, err)
+		}
+		series.Movies = []Film{}
+		data.Collections[id] = series
+	}
+	if err := rows.Err(); err != nil {
+		return data, fmt.Errorf("failed to read series of run %d: %w", runID, err)
+	}
+
+	rows, err = s.db.Query(`SELECT series_id, data FROM films WHERE run_id = ? ORDER BY series_id, position`, runID)
+	if err != nil {
+		return data, fmt.Errorf("failed to read films of run %d: %w", runID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			return data, fmt.Errorf("failed to read films of run %d: %w", runID, err)
+		}
+		var f Film
+		if err := json.Unmarshal([]byte(raw), &f); err != nil {
+			return data, fmt.Errorf("failed to decode film in series %s: %w", id, err)
+		}
+		series := data.Collections[id]
+		series.Movies = append(series.Movies, f)
+		data.Collections[id] = series
+	}
+	if err := rows.Err(); err != nil {
+		return data, fmt.Errorf("failed to read films of run %d: %w", runID, err)
+	}
+
+	return data, nil
+}
+
+// LatestRunID returns the ID of the latest run, or of the run back runs
+// before it.
+func (s *Store) LatestRunID(back int) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM runs ORDER BY id DESC LIMIT 1 OFFSET ?`, back).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("no run %s%s%d in %s", SnapshotLatest, snapshotLatestSep, back, s.path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find latest run: %w", err)
+	}
+	return id, nil
+}
+
+// SaveCrawl merges a crawl with the latest run like UpdateFileStore does with
+// the previous file, and stores the series the policy finds eligible as a new
+// run.
+func (s *Store) SaveCrawl(scrappedData map[string]Series, policy EligibilityPolicy, overrides *Overrides) (int64, error) {
+	if latest, err := s.LatestRunID(0); err == nil {
+		previous, err := s.LoadRun(latest)
+		if err != nil {
+			return 0, err
+		}
+		mergePrevious(scrappedData, previous.Collections, overrides)
+	}
+
+	filteredResults := policy.EligibleSeries(scrappedData)
+	runID, err := s.SaveRun(ScrapedData{
+		Date:        time.Now().Format(snapshotDateFormat),
+		Collections: filteredResults,
+	}, storeSourceCrawl)
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Results stored as run %d in %s\n", runID, s.path)
+	fmt.Printf("Found %d total series, %d eligible series\n", len(scrappedData), len(filteredResults))
+	return runID, nil
+}
+
+// ImportJSON stores a snapshot file as a new run.
+func (s *Store) ImportJSON(jsonFile string) (int64, error) {
+	data, err := LoadScrapedData(jsonFile)
+	if err != nil {
+		return 0, err
+	}
+	assignFilmIDs(data.Collections)
+	return s.SaveRun(data, storeSourceImportLabel+jsonFile)
+}
+
+// ExportJSON writes a snapshot in the JSON format the crawler used to write.
+func ExportJSON(data ScrapedData, outFile string) error {
+	data.SchemaVersion = SnapshotSchemaVersion
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writeFileAtomic(outFile, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outFile, err)
+	}
+
+	fmt.Printf("Wrote %d series from %s to %s\n", len(data.Collections), data.Date, outFile)
+	return nil
+}
+
+// ListRuns writes the most recent runs, newest first.
+func (s *Store) ListRuns(w io.Writer, limit int) error {
+	rows, err := s.db.Query(`
+		SELECT r.id, r.date, r.created_at, r.source,
+			(SELECT COUNT(*) FROM series WHERE run_id = r.id),
+			(SELECT COUNT(*) FROM films WHERE run_id = r.id)
+		FROM runs r ORDER BY r.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r StoreRun
+		var createdAt string
+		if err := rows.Scan(&r.ID, &r.Date, &createdAt, &r.Source, &r.Series, &r.Films); err != nil {
+			return fmt.Errorf("failed to list runs: %w", err)
+		}
+		r.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		fmt.Fprintf(w, "%6d  %s  %-20s  %3d series  %4d films  %s\n",
+			r.ID, r.Date, r.Source, r.Series, r.Films, r.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return rows.Err()
+}
+
+// RecordSyncAction logs a change made in Radarr or Agregarr for the run data
+// was loaded from. A nil Store records nothing, so callers need not check.
+func (s *Store) RecordSyncAction(data ScrapedData, a SyncAction) {
+	if s == nil {
+		return
+	}
+
+	var runID any
+	if data.runID > 0 {
+		runID = data.runID
+	}
+	errText := ""
+	if a.Err != nil {
+		errText = a.Err.Error()
+	}
+
+	_, err := s.db.Exec(`INSERT INTO sync_actions (run_id, created_at, target, action, series_id, tmdb_id, detail, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, time.Now().UTC().Format(time.RFC3339), a.Target, a.Action, a.SeriesID, a.TMDBID, a.Detail, errText)
+	if err != nil {
+		fmt.Printf("Warning: failed to record %s %s: %v\n", a.Target, a.Action, err)
+	}
+}
+
+// LoadSnapshot resolves ref to a snapshot: "latest" or "latest~N" from the
+// store, or from the snapshot dir when there is no store, anything else as a
+// JSON file. It also returns a label for output.
+func LoadSnapshot(ref string, store *Store, snapshots SnapshotConfig) (ScrapedData, string, error) {
+	if ref != SnapshotLatest && !strings.HasPrefix(ref, SnapshotLatest+snapshotLatestSep) {
+		data, err := LoadScrapedData(ref)
+		return data, ref, err
+	}
+
+	back := 0
+	if n := strings.TrimPrefix(ref, SnapshotLatest); n != "" {
+		var err error
+		back, err = strconv.Atoi(strings.TrimPrefix(n, snapshotLatestSep))
+		if err != nil || back < 0 {
+			return ScrapedData{}, ref, fmt.Errorf("invalid snapshot reference %q", ref)
+		}
+	}
+
+	if store == nil {
+		path, err := snapshots.FindSnapshot(back)
+		if err != nil {
+			return ScrapedData{}, ref, err
+		}
+		if path == "" {
+			return ScrapedData{}, ref, fmt.Errorf("no snapshot %s in %s", ref, snapshots.withDefaults().Dir)
+		}
+		data, err := LoadScrapedData(path)
+		return data, path, err
+	}
+
+	runID, err := store.LatestRunID(back)
+	if err != nil {
+		return ScrapedData{}, ref, err
+	}
+	data, err := store.LoadRun(runID)
+	return data, fmt.Sprintf("run %d", runID), err
+}
@@ -0,0 +1,592 @@
+package metrograph
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TMDB_BASE_URL string = "https://api.themoviedb.org/3"
+
+const (
+	defaultTMDBRateLimitMs   = 250
+	defaultTMDBWorkers       = 4
+	defaultTMDBCandidates    = 5
+	defaultTMDBMinConfidence = 0.6
+)
+
+type TMDBConfig struct {
+	APIKey        string
+	AccessToken   string  // v4 read access token, used instead of APIKey when set
+	RateLimitMs   int     // Token refill interval, shared by all workers
+	Burst         int     // Requests allowed back to back before RateLimitMs applies
+	MaxRetries    *int    // Retries for 429, 5xx and network errors; nil uses the default, 0 disables them
+	Workers       int     // Number of concurrent lookups
+	Candidates    int     // Number of search results scored per title variation
+	MinConfidence float64 // Matches below this keep searching other variations
+
+	CacheFile    string        // On-disk response cache, "-" disables it
+	CacheTTL     time.Duration // How long cached results stay fresh
+	CacheMissTTL time.Duration // How long cached "no results" stay fresh
+
+	ExportFile string // TMDB daily movie ID export used for offline matching
+	ExportMode string // ExportModeFirst or ExportModeFallback
+}
+
+type TMDBSearchResponse struct {
+	Results []TMDBMovie `json:"results"`
+}
+
+// TMDBMovie is a search result or, when fetched through FetchDetails, the
+// full movie details including IMDb ID, runtime and genres.
+type TMDBMovie struct {
+	ID               int         `json:"id"`
+	Title            string      `json:"title"`
+	OriginalTitle    string      `json:"original_title"`
+	OriginalLanguage string      `json:"original_language,omitempty"`
+	ReleaseDate      string      `json:"release_date"`
+	IMDBId           string      `json:"imdb_id,omitempty"`
+	Runtime          int         `json:"runtime,omitempty"`
+	Genres           []TMDBGenre `json:"genres,omitempty"`
+	PosterPath       string      `json:"poster_path,omitempty"`
+	ExternalIDs      struct {
+		IMDBId string `json:"imdb_id,omitempty"`
+	} `json:"external_ids,omitempty"`
+}
+
+type TMDBGenre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type TMDBAlternativeTitlesResponse struct {
+	Titles []struct {
+		Title string `json:"title"`
+	} `json:"titles"`
+}
+
+type TMDBCreditsResponse struct {
+	Crew []struct {
+		Name string `json:"name"`
+		Job  string `json:"job"`
+	} `json:"crew"`
+}
+
+// SeriesMatchStats counts how many films in a series were resolved to a TMDB ID.
+type SeriesMatchStats struct {
+	Name          string
+	Matched       int
+	LowConfidence int
+	Total         int
+}
+
+// Resolver looks up films on TMDB with a bounded worker pool. All workers
+// share one client so its rate limit applies to the whole pool.
+type Resolver struct {
+	config TMDBConfig
+	client *TMDBClient
+	cache  *TMDBCache
+	export *TMDBExportIndex
+}
+
+func NewResolver(config TMDBConfig) *Resolver {
+	if config.Workers <= 0 {
+		config.Workers = defaultTMDBWorkers
+	}
+	if config.Candidates <= 0 {
+		config.Candidates = defaultTMDBCandidates
+	}
+	if config.MinConfidence <= 0 {
+		config.MinConfidence = defaultTMDBMinConfidence
+	}
+	if config.ExportMode == "" {
+		config.ExportMode = ExportModeFallback
+	}
+
+	r := &Resolver{
+		config: config,
+		client: NewTMDBClient(config),
+	}
+
+	if config.CacheFile != "-" {
+		cache, err := LoadTMDBCache(config.CacheFile, config.CacheTTL, config.CacheMissTTL)
+		if err != nil {
+			fmt.Printf("Warning: TMDB cache disabled: %v\n", err)
+		} else {
+			r.cache = cache
+		}
+	}
+
+	if config.ExportFile != "" {
+		export, err := LoadTMDBExport(config.ExportFile)
+		if err != nil {
+			fmt.Printf("Warning: TMDB offline export disabled: %v\n", err)
+		} else {
+			r.export = export
+		}
+	}
+
+	return r
+}
+
+// Close persists the cache.
+func (r *Resolver) Close() error {
+	if r.cache == nil {
+		return nil
+	}
+	return r.cache.Save()
+}
+
+func (r *Resolver) PrintCacheStats() {
+	if r.cache != nil {
+		r.cache.PrintStats()
+	}
+}
+
+// cachedGet is a client request backed by the on-disk cache. empty reports
+// whether the decoded response holds no results, so it is cached with the
+// miss TTL.
+func (r *Resolver) cachedGet(ctx context.Context, key string, path string, params url.Values, out any, empty func() bool) error {
+	if r.cache != nil && r.cache.Get(key, out) {
+		return nil
+	}
+
+	if err := r.client.Get(ctx, path, params, out); err != nil {
+		return err
+	}
+
+	if r.cache != nil {
+		r.cache.Put(key, out, empty())
+	}
+	return nil
+}
+
+func (r *Resolver) searchTMDBWithTitle(ctx context.Context, title string, year int, strategy string) ([]TMDBMovie, error) {
+	params := url.Values{}
+	params.Set("query", title)
+	if year > 0 {
+		params.Set("year", fmt.Sprintf("%d", year))
+	}
+
+	var searchResp TMDBSearchResponse
+	key := tmdbCacheKey(tmdbCacheKindSearch, normalizeTitle(title), fmt.Sprintf("%d", year), strategy)
+	if err := r.cachedGet(ctx, key, "search/movie", params, &searchResp, func() bool { return len(searchResp.Results) == 0 }); err != nil {
+		return nil, err
+	}
+
+	results := searchResp.Results
+	if len(results) > r.config.Candidates {
+		results = results[:r.config.Candidates]
+	}
+	return results, nil
+}
+
+func (r *Resolver) fetchDirectors(ctx context.Context, tmdbID int) ([]string, error) {
+	var credits TMDBCreditsResponse
+	key := tmdbCacheKey(tmdbCacheKindCredits, fmt.Sprintf("%d", tmdbID))
+	if err := r.cachedGet(ctx, key, fmt.Sprintf("movie/%d/credits", tmdbID), url.Values{}, &credits, func() bool { return len(credits.Crew) == 0 }); err != nil {
+		return nil, err
+	}
+
+	directors := []string{}
+	for _, c := range credits.Crew {
+		if c.Job == "Director" {
+			directors = append(directors, c.Name)
+		}
+	}
+	return directors, nil
+}
+
+func (r *Resolver) fetchAlternativeTitles(ctx context.Context, tmdbID int) ([]string, error) {
+	var alt TMDBAlternativeTitlesResponse
+	key := tmdbCacheKey(tmdbCacheKindAltTitles, fmt.Sprintf("%d", tmdbID))
+	if err := r.cachedGet(ctx, key, fmt.Sprintf("movie/%d/alternative_titles", tmdbID), url.Values{}, &alt, func() bool { return len(alt.Titles) == 0 }); err != nil {
+		return nil, err
+	}
+
+	titles := []string{}
+	for _, t := range alt.Titles {
+		titles = append(titles, t.Title)
+	}
+	return titles, nil
+}
+
+// FetchDetails returns the full TMDB record for a movie, including its
+// external IDs.
+func (r *Resolver) FetchDetails(ctx context.Context, tmdbID int) (*TMDBMovie, error) {
+	params := url.Values{}
+	params.Set("append_to_response", "external_ids")
+
+	var movie TMDBMovie
+	key := tmdbCacheKey(tmdbCacheKindDetails, fmt.Sprintf("%d", tmdbID))
+	if err := r.cachedGet(ctx, key, fmt.Sprintf("movie/%d", tmdbID), params, &movie, func() bool { return movie.ID == 0 }); err != nil {
+		return nil, err
+	}
+
+	if movie.IMDBId == "" {
+		movie.IMDBId = movie.ExternalIDs.IMDBId
+	}
+	return &movie, nil
+}
+
+// filmSearch holds the state of a single SearchTMDB call so credits,
+// alternative titles and candidates are not fetched twice across strategies.
+type filmSearch struct {
+	ctx        context.Context
+	r          *Resolver
+	year       int
+	director   string
+	directors  map[int][]string
+	altTitles  map[int][]string
+	candidates map[int]TMDBMovie
+	best       *TMDBMatch
+}
+
+type yearAttempt struct {
+	year     int
+	strategy string
+}
+
+func (s *filmSearch) directorsFor(tmdbID int) []string {
+	if s.director == "" {
+		return nil
+	}
+	if d, ok := s.directors[tmdbID]; ok {
+		return d
+	}
+
+	d, err := s.r.fetchDirectors(s.ctx, tmdbID)
+	if err != nil {
+		fmt.Printf("  Could not fetch credits for TMDB %d: %v\n", tmdbID, err)
+	}
+	s.directors[tmdbID] = d
+	return d
+}
+
+// consider scores candidates and keeps the best match seen so far. It
+// reports whether the best match is now confident enough to stop.
+func (s *filmSearch) consider(title string, candidates []TMDBMovie, altTitles map[int][]string, strategy string) bool {
+	for _, movie := range candidates {
+		s.candidates[movie.ID] = movie
+
+		match := scoreCandidate(title, s.year, s.director, movie, s.directorsFor(movie.ID), altTitles[movie.ID])
+		match.Strategy = strategy
+		if s.best == nil || match.Confidence > s.best.Confidence {
+			s.best = &match
+		}
+	}
+	return s.best != nil && s.best.Confidence >= s.r.config.MinConfidence
+}
+
+// searchVariation runs every strategy for one title variation, stopping at
+// the first confident match: the scraped year, the years either side of it,
+// no year at all, and finally the alternative titles of every candidate
+// seen so far.
+func (s *filmSearch) searchVariation(title string) (bool, error) {
+	attempts := []yearAttempt{{s.year, StrategyExact}}
+	if s.year > 0 {
+		attempts = append(attempts,
+			yearAttempt{s.year - 1, StrategyAdjacentYear},
+			yearAttempt{s.year + 1, StrategyAdjacentYear},
+			yearAttempt{0, StrategyNoYear},
+		)
+	}
+
+	for _, a := range attempts {
+		candidates, err := s.r.searchTMDBWithTitle(s.ctx, title, a.year, a.strategy)
+		if err != nil {
+			return false, err
+		}
+		if s.consider(title, candidates, nil, a.strategy) {
+			return true, nil
+		}
+	}
+
+	candidates := []TMDBMovie{}
+	for id, movie := range s.candidates {
+		if _, ok := s.altTitles[id]; !ok {
+			titles, err := s.r.fetchAlternativeTitles(s.ctx, id)
+			if err != nil {
+				fmt.Printf("  Could not fetch alternative titles for TMDB %d: %v\n", id, err)
+				continue
+			}
+			s.altTitles[id] = titles
+		}
+		candidates = append(candidates, movie)
+	}
+	return s.consider(title, candidates, s.altTitles, StrategyAlternativeTitle), nil
+}
+
+// SearchTMDB returns the best scoring TMDB match across all title variations
+// and search strategies. It stops as soon as a match reaches MinConfidence.
+// With an offline export loaded, "first" mode tries the export's candidate
+// before searching, confirming its year and director with the API, and the
+// export answers whenever the API cannot. Export matches below MinConfidence
+// are never returned.
+func (r *Resolver) SearchTMDB(ctx context.Context, title string, year int, director string) (*TMDBMatch, error) {
+	if !r.client.Configured() {
+		if r.export != nil {
+			return r.searchExport(title, year, director)
+		}
+		return nil, fmt.Errorf("TMDB API key or access token is required")
+	}
+
+	if r.export != nil && r.config.ExportMode == ExportModeFirst {
+		if match := r.export.Match(title, year, director); match != nil {
+			confirmed, err := r.confirmExportMatch(ctx, title, year, director, match)
+			if err == nil && confirmed.Confidence >= r.config.MinConfidence {
+				return confirmed, nil
+			}
+		}
+	}
+
+	match, err := r.searchAPI(ctx, title, year, director)
+	if err != nil && r.export != nil && ctx.Err() == nil {
+		fmt.Printf("  TMDB API failed for %s, using offline export: %v\n", title, err)
+		return r.searchExport(title, year, director)
+	}
+	return match, err
+}
+
+// confirmExportMatch rescores an export match against the film's TMDB details
+// and credits, as the export has no release year or director.
+func (r *Resolver) confirmExportMatch(ctx context.Context, title string, year int, director string, match *TMDBMatch) (*TMDBMatch, error) {
+	movie, err := r.FetchDetails(ctx, match.Movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var directors []string
+	if director != "" {
+		if directors, err = r.fetchDirectors(ctx, movie.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	confirmed := scoreCandidate(title, year, director, *movie, directors, nil)
+	confirmed.Strategy = StrategyOfflineExport
+	confirmed.Reason += ", confirmed by API"
+	return &confirmed, nil
+}
+
+// searchExport matches from the export alone, for when the API cannot be
+// used.
+func (r *Resolver) searchExport(title string, year int, director string) (*TMDBMatch, error) {
+	match := r.export.Match(title, year, director)
+	if match == nil {
+		return nil, fmt.Errorf("no offline export entry for %s (%d) or any variations", title, year)
+	}
+	if match.Confidence < r.config.MinConfidence {
+		return nil, fmt.Errorf("offline export match for %s (%d) scored %.2f, below min_confidence %.2f (%s)",
+			title, year, match.Confidence, r.config.MinConfidence, match.Reason)
+	}
+	return match, nil
+}
+
+// searchAPI runs every title variation and strategy against the TMDB API.
+func (r *Resolver) searchAPI(ctx context.Context, title string, year int, director string) (*TMDBMatch, error) {
+	search := &filmSearch{
+		ctx:        ctx,
+		r:          r,
+		year:       year,
+		director:   director,
+		directors:  make(map[int][]string),
+		altTitles:  make(map[int][]string),
+		candidates: make(map[int]TMDBMovie),
+	}
+
+	// Get all title variations
+	titleVariations := cleanTitle(title)
+
+	for i, variation := range titleVariations {
+		if i > 0 {
+			fmt.Printf("  Trying variation: %s\n", variation)
+		}
+
+		ok, err := search.searchVariation(variation)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if i > 0 {
+				fmt.Printf("  Success with variation: %s\n", variation)
+			}
+			break
+		}
+	}
+
+	if search.best == nil {
+		return nil, fmt.Errorf("no results found for %s (%d) or any variations", title, year)
+	}
+	return search.best, nil
+}
+
+func SearchTMDB(ctx context.Context, title string, year int, director string, apiKey string) (*TMDBMatch, error) {
+	r := NewResolver(TMDBConfig{APIKey: apiKey})
+	defer r.Close()
+
+	return r.SearchTMDB(ctx, title, year, director)
+}
+
+// filmRef points at one film inside the results map.
+type filmRef struct {
+	seriesID string
+	index    int
+}
+
+type lookupKey struct {
+	title    string
+	year     int
+	director string
+}
+
+// runPool calls work for every key on a pool of workers and hands each
+// result to handle. handle runs on the calling goroutine only, so it may
+// write to shared state without locking.
+func runPool[K comparable, V any](workers int, keys []K, work func(K) (V, error), handle func(K, V, error)) {
+	type result struct {
+		key K
+		val V
+		err error
+	}
+
+	jobs := make(chan K)
+	found := make(chan result)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				val, err := work(key)
+				found <- result{key: key, val: val, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, key := range keys {
+			jobs <- key
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	for res := range found {
+		handle(res.key, res.val, res.err)
+	}
+}
+
+// Enrich resolves every film in results to a TMDB ID in place, then fills in
+// IMDb ID and other details for every matched film. Films that appear in
+// several series are only looked up once.
+func (r *Resolver) Enrich(ctx context.Context, results map[string]Series) map[string]SeriesMatchStats {
+	lookups := make(map[lookupKey][]filmRef)
+	for seriesID, s := range results {
+		for i, f := range s.Movies {
+			if f.TMDBID > 0 || f.Ignored {
+				continue
+			}
+			key := lookupKey{title: strings.TrimSpace(f.Title), year: f.Year, director: f.Director}
+			lookups[key] = append(lookups[key], filmRef{seriesID: seriesID, index: i})
+		}
+	}
+
+	if (r.client.Configured() || r.export != nil) && len(lookups) > 0 {
+		fmt.Printf("Resolving %d films on TMDB with %d workers\n", len(lookups), r.config.Workers)
+
+		keys := make([]lookupKey, 0, len(lookups))
+		for key := range lookups {
+			keys = append(keys, key)
+		}
+
+		runPool(r.config.Workers, keys, func(key lookupKey) (*TMDBMatch, error) {
+			return r.SearchTMDB(ctx, key.title, key.year, key.director)
+		}, func(key lookupKey, match *TMDBMatch, err error) {
+			if err != nil {
+				fmt.Printf("TMDB lookup failed for %s: %v\n", key.title, err)
+				return
+			}
+			fmt.Printf("Found TMDB ID for %s: %d via %s (confidence %.2f: %s)\n", key.title, match.Movie.ID, match.Strategy, match.Confidence, match.Reason)
+			for _, ref := range lookups[key] {
+				film := &results[ref.seriesID].Movies[ref.index]
+				film.TMDBID = match.Movie.ID
+				film.Confidence = match.Confidence
+				film.MatchReason = match.Reason
+				film.MatchStrategy = match.Strategy
+			}
+		})
+	}
+
+	r.enrichDetails(ctx, results)
+
+	stats := make(map[string]SeriesMatchStats)
+	for seriesID, s := range results {
+		st := SeriesMatchStats{Name: s.Name, Total: len(s.Movies)}
+		for _, f := range s.Movies {
+			if f.TMDBID > 0 {
+				st.Matched++
+				if f.Confidence > 0 && f.Confidence < r.config.MinConfidence {
+					st.LowConfidence++
+				}
+			}
+		}
+		stats[seriesID] = st
+	}
+
+	return stats
+}
+
+// enrichDetails fetches TMDB details for every matched film that does not
+// have them yet and copies them onto the film.
+func (r *Resolver) enrichDetails(ctx context.Context, results map[string]Series) {
+	pending := make(map[int][]filmRef)
+	for seriesID, s := range results {
+		for i, f := range s.Movies {
+			if f.TMDBID > 0 && f.IMDBID == "" {
+				pending[f.TMDBID] = append(pending[f.TMDBID], filmRef{seriesID: seriesID, index: i})
+			}
+		}
+	}
+
+	if !r.client.Configured() || len(pending) == 0 {
+		return
+	}
+
+	fmt.Printf("Fetching TMDB details for %d films\n", len(pending))
+
+	ids := make([]int, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+
+	runPool(r.config.Workers, ids, func(id int) (*TMDBMovie, error) {
+		return r.FetchDetails(ctx, id)
+	}, func(id int, movie *TMDBMovie, err error) {
+		if err != nil {
+			fmt.Printf("TMDB details failed for %d: %v\n", id, err)
+			return
+		}
+		for _, ref := range pending[id] {
+			results[ref.seriesID].Movies[ref.index].applyDetails(*movie)
+		}
+	})
+}
+
+func PrintMatchStats(stats map[string]SeriesMatchStats) {
+	matched, total := 0, 0
+	for _, st := range stats {
+		fmt.Printf("Series '%s': matched %d/%d films (%d low confidence)\n", st.Name, st.Matched, st.Total, st.LowConfidence)
+		matched += st.Matched
+		total += st.Total
+	}
+	fmt.Printf("Matched %d/%d films across %d series\n", matched, total, len(stats))
+}
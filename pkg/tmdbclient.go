@@ -0,0 +1,251 @@
+package metrograph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTMDBBurst      = 4
+	defaultTMDBMaxRetries = 4
+	tmdbBaseBackoff       = 500 * time.Millisecond
+	tmdbMaxBackoff        = 30 * time.Second
+)
+
+// TMDBError is returned for failed requests. StatusCode is 0 when the
+// request never got a response. It never includes the request query so API
+// keys cannot leak into logs.
+type TMDBError struct {
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *TMDBError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("TMDB %s request failed: %s", e.Path, e.Message)
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("TMDB %s returned status %d: %s", e.Path, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("TMDB %s returned status %d", e.Path, e.StatusCode)
+}
+
+func (e *TMDBError) retryable() bool {
+	return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// tokenBucket allows up to capacity requests at once and refills one token
+// per interval.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	interval time.Duration
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, interval time.Duration) *tokenBucket {
+	return &tokenBucket{
+		tokens:   float64(capacity),
+		capacity: float64(capacity),
+		interval: interval,
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) * float64(b.interval))
+		b.mu.Unlock()
+
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// TMDBClient talks to the TMDB API. It authenticates with a v4 read access
+// token when one is configured and falls back to the v3 api_key parameter.
+// Every request goes through one shared token bucket, and 429 and 5xx
+// responses are retried with exponential backoff honouring Retry-After.
+type TMDBClient struct {
+	apiKey      string
+	accessToken string
+	maxRetries  int
+	httpClient  *http.Client
+	limiter     *tokenBucket
+}
+
+func NewTMDBClient(config TMDBConfig) *TMDBClient {
+	rateLimit := config.RateLimitMs
+	if rateLimit <= 0 {
+		rateLimit = defaultTMDBRateLimitMs
+	}
+	burst := config.Burst
+	if burst <= 0 {
+		burst = defaultTMDBBurst
+	}
+	maxRetries := defaultTMDBMaxRetries
+	if config.MaxRetries != nil {
+		maxRetries = max(*config.MaxRetries, 0)
+	}
+
+	return &TMDBClient{
+		apiKey:      config.APIKey,
+		accessToken: config.AccessToken,
+		maxRetries:  maxRetries,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		limiter: newTokenBucket(burst, time.Duration(rateLimit)*time.Millisecond),
+	}
+}
+
+// Configured reports whether the client has any credentials.
+func (c *TMDBClient) Configured() bool {
+	return c.apiKey != "" || c.accessToken != ""
+}
+
+// redact strips credentials from an error message.
+func (c *TMDBClient) redact(msg string) string {
+	for _, secret := range []string{c.apiKey, c.accessToken} {
+		if secret != "" {
+			msg = strings.ReplaceAll(msg, secret, "REDACTED")
+		}
+	}
+	return msg
+}
+
+// Get fetches path with params and decodes the JSON response into out.
+func (c *TMDBClient) Get(ctx context.Context, path string, params url.Values, out any) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	if c.accessToken == "" {
+		params.Set("api_key", c.apiKey)
+	}
+	reqURL := fmt.Sprintf("%s/%s?%s", TMDB_BASE_URL, path, params.Encode())
+
+	backoff := tmdbBaseBackoff
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		retryAfter, err := c.do(ctx, path, reqURL, out)
+		if err == nil {
+			return nil
+		}
+
+		var tmdbErr *TMDBError
+		if !errors.As(err, &tmdbErr) || !tmdbErr.retryable() || attempt >= c.maxRetries {
+			return err
+		}
+
+		delay := backoff
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		fmt.Printf("  %v, retrying in %s (attempt %d/%d)\n", err, delay, attempt+1, c.maxRetries)
+		if err := sleepCtx(ctx, delay); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, tmdbMaxBackoff)
+	}
+}
+
+// do performs a single request. On a retryable failure it also returns the
+// delay requested by the server's Retry-After header, if any.
+func (c *TMDBClient) do(ctx context.Context, path string, reqURL string, out any) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create TMDB request for %s: %s", path, c.redact(err.Error()))
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// *url.Error includes the full URL, so only keep the cause
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		return 0, &TMDBError{Path: path, Message: c.redact(err.Error())}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			StatusMessage string `json:"status_message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(data, &body)
+
+		return parseRetryAfter(resp.Header.Get("Retry-After")), &TMDBError{
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Message:    c.redact(body.StatusMessage),
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("failed to decode TMDB %s response: %w", path, err)
+	}
+	return 0, nil
+}
+
+// parseRetryAfter accepts both forms of the header: delay seconds or an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}